@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+const (
+	defaultDeletionGrace = 30 * 24 * time.Hour
+	accountPurgeInterval = time.Hour
+	accountPurgeBatch    = 100
+)
+
+// loadDeletionGrace reads how long a deleted account can still be restored
+// from ACCOUNT_DELETION_GRACE, such as "720h".
+func loadDeletionGrace() (time.Duration, error) {
+	raw := os.Getenv("ACCOUNT_DELETION_GRACE")
+	if raw == "" {
+		return defaultDeletionGrace, nil
+	}
+	grace, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ACCOUNT_DELETION_GRACE: %w", err)
+	}
+	if grace < 0 {
+		return 0, fmt.Errorf("invalid ACCOUNT_DELETION_GRACE: %s is negative", raw)
+	}
+	return grace, nil
+}
+
+// handleDeleteUser schedules the account for deletion once the grace period
+// is over. The user is signed out everywhere, and logging back in before
+// then restores the account.
+func (cfg *apiConfig) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	params := struct {
+		Password string `json:"password"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+
+	user, err := cfg.Db.GetUserById(r.Context(), userid)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	// A stolen access token alone shouldn't be enough to delete the account,
+	// and guesses at the password count against the login throttle.
+	if !cfg.checkLoginThrottle(w, r, user.Email) {
+		return
+	}
+	match, err := auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	if err != nil {
+		log.Printf("could not verify password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete account")
+		return
+	}
+	if !match {
+		cfg.loginFailed(r, user.Email, &user, outcomeBadCredentials)
+		respondWithError(w, http.StatusUnauthorized, "incorrect password")
+		return
+	}
+
+	user, err = cfg.Db.ScheduleUserDeletion(r.Context(), database.ScheduleUserDeletionParams{
+		DeleteAfter: time.Now().Add(cfg.deletion_grace),
+		ID:          user.ID,
+	})
+	if err != nil {
+		log.Printf("error scheduling account deletion: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete account")
+		return
+	}
+
+	if err = cfg.revokeAllSessions(r.Context(), user.ID); err != nil {
+		log.Printf("error revoking sessions: %s", err)
+	}
+
+	logSecurityEvent(r, "account_deletion_requested", user.ID, "deleting after %s", user.DeleteAfter.Time.Format(time.RFC3339))
+	respondWithJSON(w, http.StatusAccepted, struct {
+		DeleteAfter time.Time `json:"delete_after"`
+	}{user.DeleteAfter.Time})
+}
+
+// restoreAccount cancels a pending deletion when the user logs back in
+// during the grace period.
+func (cfg *apiConfig) restoreAccount(r *http.Request, user database.User) {
+	restored, err := cfg.Db.CancelUserDeletion(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("error cancelling account deletion: %s", err)
+		return
+	}
+	if restored > 0 {
+		logSecurityEvent(r, "account_restored", user.ID, "deletion cancelled by login")
+	}
+}
+
+// runAccountPurger hard deletes accounts whose grace period is over, until
+// ctx is done.
+func (cfg *apiConfig) runAccountPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cfg.purgeDeletedAccounts(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) purgeDeletedAccounts(ctx context.Context) {
+	for {
+		due, err := cfg.Db.ListUsersDueForDeletion(ctx, accountPurgeBatch)
+		if err != nil {
+			log.Printf("error listing accounts due for deletion: %s", err)
+			return
+		}
+
+		purged := 0
+		for _, user := range due {
+			// The export rows cascade with the user, their files don't.
+			exports, err := cfg.Db.ListUserDataExports(ctx, user.ID)
+			if err != nil {
+				log.Printf("error listing data exports: %s", err)
+				continue
+			}
+
+			// PurgeUser rechecks the deadline, so a login that restored the
+			// account in the meantime wins.
+			deleted, err := cfg.Db.PurgeUser(ctx, user.ID)
+			if err != nil {
+				log.Printf("error deleting account: %s", err)
+				continue
+			}
+			if deleted == 0 {
+				continue
+			}
+			purged++
+			for _, export := range exports {
+				cfg.removeExportFile(export.ID)
+			}
+
+			// Login history outlives the user otherwise, and it's keyed by email.
+			if err = cfg.Db.DeleteLoginAttemptsByEmail(ctx, user.Email); err != nil {
+				log.Printf("error deleting login attempts: %s", err)
+			}
+			if err = cfg.account_guard.Reset(ctx, accountThrottleKey(user.Email)); err != nil {
+				log.Printf("error clearing login throttle: %s", err)
+			}
+			log.Print("deleted an account whose grace period was over")
+		}
+
+		if purged == 0 || len(due) < accountPurgeBatch {
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+// testQueries connects to the migrated database in TEST_DB_URL, skipping the
+// test when there isn't one.
+func testQueries(t *testing.T) *database.Queries {
+	t.Helper()
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return database.New(db)
+}
+
+func TestPendingDeletionHidesChirps(t *testing.T) {
+	ctx := context.Background()
+	cfg := &apiConfig{Db: testQueries(t)}
+
+	user, err := cfg.Db.CreateUser(ctx, database.CreateUserParams{
+		Email:          uuid.NewString() + "@example.com",
+		HashedPassword: "unused",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cfg.Db.ScheduleUserDeletion(ctx, database.ScheduleUserDeletionParams{DeleteAfter: time.Now().Add(-time.Minute), ID: user.ID})
+		cfg.Db.PurgeUser(ctx, user.ID)
+	})
+	if _, err = cfg.Db.CreateChirp(ctx, database.CreateChirpParams{Body: "still here", UserID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := func() int {
+		t.Helper()
+		chirps, err := cfg.Db.ListChirpsBefore(ctx, database.ListChirpsBeforeParams{
+			CursorCreatedAt: maxCursor.CreatedAt,
+			CursorID:        maxCursor.ID,
+			AuthorID:        uuid.NullUUID{UUID: user.ID, Valid: true},
+			PageSize:        10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(chirps)
+	}
+
+	if _, err = cfg.Db.ScheduleUserDeletion(ctx, database.ScheduleUserDeletionParams{DeleteAfter: time.Now().Add(time.Hour), ID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if n := feed(); n != 0 {
+		t.Fatalf("expected the chirps of an account pending deletion to be hidden, got %d", n)
+	}
+
+	cfg.restoreAccount(httptest.NewRequest("POST", "/api/login", nil), user)
+	if n := feed(); n != 1 {
+		t.Fatalf("expected the chirp back after restoring the account, got %d", n)
+	}
+}
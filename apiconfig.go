@@ -4,15 +4,33 @@ import (
 	"fmt"
 	"net/http"
 	"sync/atomic"
+	"time"
 
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/authn"
 	"github.com/zic20/chirpy/internal/database"
+	"github.com/zic20/chirpy/internal/loginguard"
+	"github.com/zic20/chirpy/internal/mailer"
+	"github.com/zic20/chirpy/internal/signedurl"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	Db             *database.Queries
-	jwt_secret     string
-	polka_key      string
+	fileserverHits     atomic.Int32
+	Db                 *database.Queries
+	jwt_keys           *auth.KeySet
+	authenticator      *authn.Authenticator
+	polka_key          string
+	mailer             mailer.Mailer
+	base_url           string
+	platform           string
+	deletion_grace     time.Duration
+	export_dir         string
+	export_signer      *signedurl.Signer
+	export_jobs        chan struct{}
+	account_guard      *loginguard.Guard
+	ip_guard           *loginguard.Guard
+	mail_account_guard *loginguard.Guard
+	mail_ip_guard      *loginguard.Guard
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
@@ -29,8 +47,14 @@ func (cfg *apiConfig) getMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(fmt.Sprintf("<html><body><h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited %d times!</p></body></html>", hits)))
 }
 
+// resetMetrics wipes the database, so it only works when PLATFORM=dev.
 func (cfg *apiConfig) resetMetrics(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	if cfg.platform != "dev" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Reset is only allowed in dev environment"))
+		return
+	}
 	if err := cfg.Db.Reset(r.Context()); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("Failed to reset the database: " + err.Error()))
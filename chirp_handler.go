@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"sort"
 	"strings"
 	"time"
 
@@ -14,30 +15,143 @@ import (
 )
 
 type ChirpResponse struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Body         string     `json:"body"`
+	UserID       uuid.UUID  `json:"user_id"`
+	InReplyTo    *uuid.UUID `json:"in_reply_to,omitempty"`
+	RechirpOf    *uuid.UUID `json:"rechirp_of,omitempty"`
+	QuoteOf      *uuid.UUID `json:"quote_of,omitempty"`
+	Edited       bool       `json:"edited"`
+	Deleted      bool       `json:"deleted,omitempty"`
+	LikeCount    int64      `json:"like_count"`
+	LikedByMe    bool       `json:"liked_by_me"`
+	RechirpCount int64      `json:"rechirp_count"`
+	Mentions     []Mention  `json:"mentions"`
+	Snippet      string     `json:"snippet,omitempty"`
 }
 
-func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+var blockedWords = map[string]struct{}{
+	"herfuffle": {},
+	"sharbert":  {},
+	"fornax":    {},
+}
+
+func newChirpResponse(chirp database.Chirp) ChirpResponse {
+	response := ChirpResponse{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID,
+		Edited:    chirp.EditedAt.Valid,
+		Deleted:   chirp.DeletedAt.Valid,
+		Mentions:  []Mention{},
+	}
+	if chirp.InReplyTo.Valid {
+		response.InReplyTo = &chirp.InReplyTo.UUID
+	}
+	if chirp.RechirpOf.Valid {
+		response.RechirpOf = &chirp.RechirpOf.UUID
+	}
+	if chirp.QuoteOf.Valid {
+		response.QuoteOf = &chirp.QuoteOf.UUID
+	}
+	return response
+}
+
+// chirpResponses builds the responses for chirps together with their
+// engagement counts, as seen by viewer. viewer is uuid.Nil for anonymous
+// requests.
+func (cfg *apiConfig) chirpResponses(ctx context.Context, chirps []database.Chirp, viewer uuid.UUID) ([]ChirpResponse, error) {
+	response := []ChirpResponse{}
+	if len(chirps) == 0 {
+		return response, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		ids = append(ids, chirp.ID)
+	}
+
+	counts, err := cfg.Db.GetLikeCounts(ctx, ids)
 	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
+		return nil, err
+	}
+	likeCounts := map[uuid.UUID]int64{}
+	for _, count := range counts {
+		likeCounts[count.ChirpID] = count.LikeCount
 	}
-	userid, err := auth.ValidateJWT(token, cfg.jwt_secret)
+
+	rechirps, err := cfg.Db.GetRechirpCounts(ctx, ids)
 	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
+		return nil, err
+	}
+	rechirpCounts := map[uuid.UUID]int64{}
+	for _, count := range rechirps {
+		rechirpCounts[count.RechirpOf.UUID] = count.RechirpCount
+	}
+
+	mentions, err := cfg.Db.ListChirpMentions(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	chirpMentions := map[uuid.UUID][]Mention{}
+	for _, m := range mentions {
+		chirpMentions[m.ChirpID] = append(chirpMentions[m.ChirpID], Mention{UserID: m.UserID, Username: m.Username.String})
+	}
+
+	liked := map[uuid.UUID]bool{}
+	if viewer != uuid.Nil {
+		likedIDs, err := cfg.Db.ListLikedChirpIDs(ctx, database.ListLikedChirpIDsParams{
+			UserID:   viewer,
+			ChirpIds: ids,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range likedIDs {
+			liked[id] = true
+		}
+	}
+
+	for _, chirp := range chirps {
+		res := newChirpResponse(chirp)
+		res.LikeCount = likeCounts[chirp.ID]
+		res.LikedByMe = liked[chirp.ID]
+		res.RechirpCount = rechirpCounts[chirp.ID]
+		if m, ok := chirpMentions[chirp.ID]; ok {
+			res.Mentions = m
+		}
+		response = append(response, res)
+	}
+
+	return response, nil
+}
+
+func (cfg *apiConfig) chirpResponse(ctx context.Context, chirp database.Chirp, viewer uuid.UUID) (ChirpResponse, error) {
+	response, err := cfg.chirpResponses(ctx, []database.Chirp{chirp}, viewer)
+	if err != nil {
+		return ChirpResponse{}, err
 	}
+	return response[0], nil
+}
+
+// viewerID returns the user behind an optional bearer token, or uuid.Nil when
+// the request is anonymous or the token can't read chirps.
+func (cfg *apiConfig) viewerID(r *http.Request) uuid.UUID {
+	return principal(r).UserID
+}
+
+func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
 	w.Header().Set("Content-Type", "application/json")
 	type params struct {
-		Body   string    `json:"body"`
-		UserID uuid.UUID `json:"user_id"`
+		Body      string     `json:"body"`
+		UserID    uuid.UUID  `json:"user_id"`
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
+		QuoteOf   *uuid.UUID `json:"quote_of"`
 	}
 	type errResBody struct {
 		Error string `json:"error"`
@@ -49,29 +163,47 @@ func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request)
 	decoder := json.NewDecoder(r.Body)
 	reqBody := params{}
 
-	err = decoder.Decode(&reqBody)
+	err := decoder.Decode(&reqBody)
 	if err != nil {
 		log.Printf("Error parsing request body: %s\n", err)
 		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
 		return
 	}
 
-	if len(reqBody.Body) > 140 {
-		log.Printf("Chirp was too long: %d characters\n", len(reqBody.Body))
-		respondWithError(w, http.StatusBadRequest, "Chirp is too long")
+	text, err := prepareChirpBody(reqBody.Body)
+	if err != nil {
+		log.Printf("%s: %d characters\n", err, len(reqBody.Body))
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	blockedWords := map[string]struct{}{
-		"herfuffle": {},
-		"sharbert":  {},
-		"fornax":    {},
+	var inReplyTo uuid.NullUUID
+	if reqBody.InReplyTo != nil {
+		parent, err := cfg.Db.GetChirp(r.Context(), *reqBody.InReplyTo)
+		if err != nil || parent.DeletedAt.Valid {
+			log.Printf("chirp being replied to not found: %v", err)
+			respondWithError(w, http.StatusBadRequest, "chirp being replied to does not exist")
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+
+	var quoteOf uuid.NullUUID
+	if reqBody.QuoteOf != nil {
+		quoted, err := cfg.originalChirp(r.Context(), *reqBody.QuoteOf)
+		if err != nil {
+			log.Printf("chirp being quoted not found: %v", err)
+			respondWithError(w, http.StatusBadRequest, "chirp being quoted does not exist")
+			return
+		}
+		quoteOf = uuid.NullUUID{UUID: quoted.ID, Valid: true}
 	}
-	text := cleanBody(reqBody.Body, blockedWords)
 
 	chirp, err := cfg.Db.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   text,
-		UserID: userid,
+		Body:      text,
+		UserID:    userid,
+		InReplyTo: inReplyTo,
+		QuoteOf:   quoteOf,
 	})
 
 	if err != nil {
@@ -79,45 +211,59 @@ func (cfg *apiConfig) handleCreateChirp(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "couldn't create chirp")
 		return
 	}
-	responsse := ChirpResponse{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID,
+	if err = cfg.indexChirpEntities(r.Context(), chirp); err != nil {
+		log.Printf("error indexing chirp entities: %s", err)
 	}
-	respondWithJSON(w, 201, responsse)
-}
-
-func (cfg *apiConfig) handleDeleteChirp(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
+	response, err := cfg.chirpResponse(r.Context(), chirp, userid)
 	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, http.StatusUnauthorized, err.Error())
+		log.Printf("error building chirp response: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't create chirp")
 		return
 	}
-	userid, err := auth.ValidateJWT(token, cfg.jwt_secret)
+	respondWithJSON(w, 201, response)
+}
+
+func (cfg *apiConfig) handleDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	caller := principal(r)
+	userid := caller.UserID
+	chirpuuid, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, http.StatusUnauthorized, err.Error())
+		log.Printf("error parsing chirpID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id")
 		return
 	}
-	chirpid := r.PathValue("chirpID")
-	chirpuuid, err := uuid.Parse(chirpid)
 	chirp, err := cfg.Db.GetChirp(r.Context(), chirpuuid)
-	if err != nil {
-		log.Printf("chirp not found: %s", err)
+	if err != nil || chirp.DeletedAt.Valid {
+		log.Printf("chirp not found: %v", err)
 		respondWithError(w, http.StatusNotFound, "chirp not found")
 		return
 	}
 
-	if chirp.UserID != userid {
+	if chirp.UserID != userid && !caller.HasRole(auth.RoleModerator) {
 		log.Print("User not authorized to delete this chirp")
 		respondWithError(w, http.StatusForbidden, "user not authorized to perform this action")
 		return
 	}
+	if chirp.UserID != userid {
+		logSecurityEvent(r, "chirp_moderated", userid, "deleted chirp %s by %s", chirp.ID, chirp.UserID)
+	}
 
-	if err = cfg.Db.DeleteChirp(r.Context(), chirp.ID); err != nil {
+	// Chirps that are replied to or quoted are tombstoned rather than
+	// deleted so the rest of the conversation survives. Plain rechirps go
+	// away with the original either way.
+	hasDependents, err := cfg.Db.ChirpHasDependents(r.Context(), chirp.ID)
+	if err != nil {
+		log.Printf("Error checking chirp dependents: %s", err.Error())
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete chirp")
+		return
+	}
+
+	if hasDependents {
+		err = cfg.Db.TombstoneChirp(r.Context(), chirp.ID)
+	} else {
+		err = cfg.Db.DeleteChirp(r.Context(), chirp.ID)
+	}
+	if err != nil {
 		log.Printf("Error deleting chirp: %s", err.Error())
 		respondWithError(w, http.StatusInternalServerError, "couldn't delete chirp")
 		return
@@ -126,6 +272,128 @@ func (cfg *apiConfig) handleDeleteChirp(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (cfg *apiConfig) handleUpdateChirp(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+	chirpuuid, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("error parsing chirpID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id")
+		return
+	}
+	chirp, err := cfg.Db.GetChirp(r.Context(), chirpuuid)
+	if err != nil || chirp.DeletedAt.Valid {
+		log.Printf("chirp not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+
+	if chirp.UserID != userid {
+		log.Print("User not authorized to edit this chirp")
+		respondWithError(w, http.StatusForbidden, "user not authorized to perform this action")
+		return
+	}
+
+	if chirp.RechirpOf.Valid {
+		respondWithError(w, http.StatusBadRequest, "rechirps cannot be edited")
+		return
+	}
+
+	type params struct {
+		Body string `json:"body"`
+	}
+	reqBody := params{}
+	if err = json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		log.Printf("Error parsing request body: %s\n", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong")
+		return
+	}
+
+	text, err := prepareChirpBody(reqBody.Body)
+	if err != nil {
+		log.Printf("%s: %d characters\n", err, len(reqBody.Body))
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if text != chirp.Body {
+		chirp, err = cfg.Db.EditChirp(r.Context(), database.EditChirpParams{
+			ID:   chirp.ID,
+			Body: text,
+		})
+		if err != nil {
+			log.Printf("error editing chirp: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "couldn't edit chirp")
+			return
+		}
+		if err = cfg.indexChirpEntities(r.Context(), chirp); err != nil {
+			log.Printf("error indexing chirp entities: %s", err)
+		}
+	}
+
+	response, err := cfg.chirpResponse(r.Context(), chirp, userid)
+	if err != nil {
+		log.Printf("error building chirp response: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't edit chirp")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handleGetChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	type revisionResponse struct {
+		ID        uuid.UUID `json:"id"`
+		Body      string    `json:"body"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	chirpuuid, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("error parsing chirpID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id")
+		return
+	}
+	chirp, err := cfg.Db.GetChirp(r.Context(), chirpuuid)
+	if err != nil || chirp.DeletedAt.Valid {
+		log.Printf("chirp not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+
+	revisions, err := cfg.Db.ListChirpRevisions(r.Context(), chirp.ID)
+	if err != nil {
+		log.Printf("error fetching chirp revisions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching chirp revisions")
+		return
+	}
+
+	response := []revisionResponse{}
+	for _, revision := range revisions {
+		response = append(response, revisionResponse{
+			ID:        revision.ID,
+			Body:      revision.Body,
+			CreatedAt: revision.CreatedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// indexChirpEntities refreshes the hashtags and mentions stored for chirp.
+func (cfg *apiConfig) indexChirpEntities(ctx context.Context, chirp database.Chirp) error {
+	if err := cfg.indexChirpHashtags(ctx, chirp); err != nil {
+		return err
+	}
+	return cfg.indexChirpMentions(ctx, chirp)
+}
+
+// prepareChirpBody enforces the length limit and masks blocked words.
+func prepareChirpBody(body string) (string, error) {
+	if len(body) > 140 {
+		return "", errors.New("Chirp is too long")
+	}
+	return cleanBody(body, blockedWords), nil
+}
+
 func cleanBody(body string, blockedWords map[string]struct{}) string {
 	words := strings.Split(body, " ")
 	for i, word := range words {
@@ -146,17 +414,30 @@ func (cfg *apiConfig) handleGetChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, ChirpResponse{
-		chirp.ID, chirp.CreatedAt, chirp.UpdatedAt, chirp.Body, chirp.UserID,
-	})
+	if chirp.DeletedAt.Valid {
+		respondWithError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	response, err := cfg.chirpResponse(r.Context(), chirp, cfg.viewerID(r))
+	if err != nil {
+		log.Printf("error building chirp response: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching chirp")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
 }
 
 func (cfg *apiConfig) handleGetAllChirps(w http.ResponseWriter, r *http.Request) {
-	response := []ChirpResponse{}
 	author_id := r.URL.Query().Get("author_id")
-	sort_query := r.URL.Query().Get("sort")
-	var chirps []database.Chirp
-	var err error
+	page, err := parsePageParams(r)
+	if err != nil {
+		log.Printf("error parsing pagination params: %v", err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var author uuid.NullUUID
 	if author_id != "" {
 		user_id, err := uuid.Parse(author_id)
 		if err != nil {
@@ -164,10 +445,25 @@ func (cfg *apiConfig) handleGetAllChirps(w http.ResponseWriter, r *http.Request)
 			respondWithError(w, http.StatusInternalServerError, "author_id could not be parsed")
 			return
 		}
+		author = uuid.NullUUID{UUID: user_id, Valid: true}
+	}
 
-		chirps, err = cfg.Db.GetChirpsForUser(r.Context(), user_id)
+	bound := page.bound()
+	var chirps []database.Chirp
+	if page.ascending() {
+		chirps, err = cfg.Db.ListChirpsAfter(r.Context(), database.ListChirpsAfterParams{
+			CursorCreatedAt: bound.CreatedAt,
+			CursorID:        bound.ID,
+			AuthorID:        author,
+			PageSize:        page.fetchSize(),
+		})
 	} else {
-		chirps, err = cfg.Db.GetAllChirps(r.Context())
+		chirps, err = cfg.Db.ListChirpsBefore(r.Context(), database.ListChirpsBeforeParams{
+			CursorCreatedAt: bound.CreatedAt,
+			CursorID:        bound.ID,
+			AuthorID:        author,
+			PageSize:        page.fetchSize(),
+		})
 	}
 	if err != nil {
 		log.Printf("Error fetching chirps: %s", err.Error())
@@ -175,13 +471,19 @@ func (cfg *apiConfig) handleGetAllChirps(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if sort_query == "desc" {
-		sort.Slice(chirps, func(i, j int) bool { return chirps[i].CreatedAt.After(chirps[j].CreatedAt) })
-	}
+	chirps, next, prev := paginate(page, chirps, chirpCursor)
+	setPageLinks(w, r, next, prev)
 
-	for _, chirp := range chirps {
-		response = append(response, ChirpResponse{chirp.ID, chirp.CreatedAt, chirp.UpdatedAt, chirp.Body, chirp.UserID})
+	response, err := cfg.chirpResponses(r.Context(), chirps, cfg.viewerID(r))
+	if err != nil {
+		log.Printf("error building chirp responses: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching chirps")
+		return
 	}
 
 	respondWithJSON(w, http.StatusOK, response)
 }
+
+func chirpCursor(chirp database.Chirp) pageCursor {
+	return pageCursor{CreatedAt: chirp.CreatedAt, ID: chirp.ID}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/database"
+	"github.com/zic20/chirpy/internal/mailer"
+)
+
+const emailVerificationLifetime = 24 * time.Hour
+
+// sendEmailVerification mails a token proving the user controls email, which
+// the client sends back to POST /api/users/verify-email. Only the most recent
+// token stays valid.
+func (cfg *apiConfig) sendEmailVerification(ctx context.Context, user database.User, email string) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	if err = cfg.Db.DeleteUnusedEmailVerificationTokens(ctx, user.ID); err != nil {
+		return err
+	}
+	if err = cfg.Db.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     email,
+		ExpiresAt: time.Now().Add(emailVerificationLifetime),
+	}); err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your Chirpy email address",
+		Body: fmt.Sprintf("Enter this verification token in Chirpy within the next 24 hours to confirm this address for your Chirpy account:\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.\n", token),
+	})
+}
+
+func (cfg *apiConfig) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	params := struct {
+		Token string `json:"token"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+
+	verification, err := cfg.Db.UseEmailVerificationToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		log.Printf("invalid email verification token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid or expired verification token")
+		return
+	}
+
+	confirmed, err := cfg.Db.ConfirmUserEmail(r.Context(), database.ConfirmUserEmailParams{
+		Email: verification.Email,
+		ID:    verification.UserID,
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		respondWithError(w, http.StatusConflict, "email is already in use")
+		return
+	}
+	if err != nil {
+		log.Printf("error confirming email: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't verify email")
+		return
+	}
+	if confirmed == 0 {
+		// The user has since asked to change to a different address.
+		respondWithError(w, http.StatusBadRequest, "invalid or expired verification token")
+		return
+	}
+
+	user, err := cfg.Db.GetUserById(r.Context(), verification.UserID)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't verify email")
+		return
+	}
+
+	logSecurityEvent(r, "email_verified", user.ID, "verified %s", verification.Email)
+	respondWithJSON(w, http.StatusOK, newUser(user))
+}
+
+func (cfg *apiConfig) handleResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	user, err := cfg.Db.GetUserById(r.Context(), userid)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	email := user.Email
+	if user.PendingEmail.Valid {
+		email = user.PendingEmail.String
+	} else if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "email is already verified")
+		return
+	}
+
+	if err = cfg.sendEmailVerification(r.Context(), user, email); err != nil {
+		log.Printf("error sending email verification: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't send verification email")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/database"
+	"github.com/zic20/chirpy/internal/dataexport"
+	"github.com/zic20/chirpy/internal/signedurl"
+)
+
+const (
+	// exportLifetime is how long a finished archive is kept on disk.
+	exportLifetime     = 7 * 24 * time.Hour
+	exportLinkLifetime = time.Hour
+	exportPollInterval = time.Minute
+	// Exports running longer than this are assumed to have lost their worker.
+	exportStaleAfter = 30 * time.Minute
+)
+
+type DataExport struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+func newDataExport(export database.DataExport) DataExport {
+	response := DataExport{
+		ID:        export.ID,
+		Status:    export.Status,
+		CreatedAt: export.CreatedAt,
+	}
+	if export.CompletedAt.Valid {
+		response.CompletedAt = &export.CompletedAt.Time
+	}
+	if export.ExpiresAt.Valid {
+		response.ExpiresAt = &export.ExpiresAt.Time
+	}
+	return response
+}
+
+// loadExportStore reads where archives are kept from EXPORT_DIR and the key
+// download links are signed with from EXPORT_SIGNING_KEY. Without a key a
+// random one is used, and links stop working when the server restarts.
+//
+// The directory must not be under the one served at /app/, or archives
+// could be fetched without a signed link.
+func loadExportStore() (string, *signedurl.Signer, error) {
+	dir := envOr("EXPORT_DIR", filepath.Join(os.TempDir(), "chirpy-exports"))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", nil, fmt.Errorf("creating EXPORT_DIR: %w", err)
+	}
+
+	key := []byte(os.Getenv("EXPORT_SIGNING_KEY"))
+	if len(key) == 0 {
+		log.Print("EXPORT_SIGNING_KEY not set, export download links won't survive a restart")
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return dir, signedurl.New(key), nil
+}
+
+func (cfg *apiConfig) exportPath(id uuid.UUID) string {
+	return filepath.Join(cfg.export_dir, id.String()+".zip")
+}
+
+// handleRequestExport queues an archive of the caller's data. While one is
+// still being built, asking again returns that one.
+func (cfg *apiConfig) handleRequestExport(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	export, err := cfg.Db.GetActiveDataExport(r.Context(), userid)
+	if errors.Is(err, sql.ErrNoRows) {
+		export, err = cfg.Db.CreateDataExport(r.Context(), userid)
+		if err == nil {
+			logSecurityEvent(r, "data_export_requested", userid, "export %s", export.ID)
+			cfg.wakeExportWorker()
+		}
+	}
+	if err != nil {
+		log.Printf("error queueing data export: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't start export")
+		return
+	}
+
+	w.Header().Set("Location", "/api/users/export/"+export.ID.String())
+	respondWithJSON(w, http.StatusAccepted, newDataExport(export))
+}
+
+// handleGetExport reports on an export, with a short-lived download link
+// once it's ready.
+func (cfg *apiConfig) handleGetExport(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	exportid, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		log.Printf("error parsing exportID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid export id")
+		return
+	}
+
+	export, err := cfg.Db.GetDataExport(r.Context(), database.GetDataExportParams{
+		ID:     exportid,
+		UserID: userid,
+	})
+	if err != nil {
+		log.Printf("couldn't fetch data export: %s", err)
+		respondWithError(w, http.StatusNotFound, "export not found")
+		return
+	}
+
+	response := newDataExport(export)
+	if export.Status == "ready" {
+		expires := time.Now().Add(exportLinkLifetime)
+		if export.ExpiresAt.Time.Before(expires) {
+			expires = export.ExpiresAt.Time
+		}
+		response.DownloadURL = cfg.base_url + cfg.export_signer.Sign(fmt.Sprintf("/api/exports/%s/download", export.ID), expires)
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// handleDownloadExport serves an archive to whoever holds a valid signed
+// link, so it works from a browser without the access token.
+func (cfg *apiConfig) handleDownloadExport(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.export_signer.Verify(r.URL); err != nil {
+		log.Printf("invalid export download link: %s", err)
+		respondWithError(w, http.StatusForbidden, "invalid or expired download link")
+		return
+	}
+
+	exportid, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid export id")
+		return
+	}
+	export, err := cfg.Db.GetDataExportByID(r.Context(), exportid)
+	if err != nil || export.Status != "ready" || !export.ExpiresAt.Time.After(time.Now()) {
+		respondWithError(w, http.StatusNotFound, "export not found")
+		return
+	}
+
+	f, err := os.Open(cfg.exportPath(export.ID))
+	if err != nil {
+		log.Printf("error opening data export: %s", err)
+		respondWithError(w, http.StatusNotFound, "export not found")
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, export.CreatedAt.Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, "", export.CompletedAt.Time, f)
+}
+
+func (cfg *apiConfig) wakeExportWorker() {
+	select {
+	case cfg.export_jobs <- struct{}{}:
+	default:
+	}
+}
+
+// runExportWorker builds queued exports and clears out expired ones until
+// ctx is done. It wakes up when an export is requested, and every
+// exportPollInterval to pick up any it missed.
+func (cfg *apiConfig) runExportWorker(ctx context.Context) {
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := cfg.Db.RequeueStaleDataExports(ctx, time.Now().Add(-exportStaleAfter)); err != nil {
+			log.Printf("error requeueing stale data exports: %s", err)
+		}
+		for cfg.buildNextExport(ctx) {
+		}
+		cfg.deleteExpiredExports(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-cfg.export_jobs:
+		}
+	}
+}
+
+// buildNextExport builds the oldest queued export, returning false once the
+// queue is empty.
+func (cfg *apiConfig) buildNextExport(ctx context.Context) bool {
+	export, err := cfg.Db.ClaimDataExport(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+	if err != nil {
+		log.Printf("error claiming data export: %s", err)
+		return false
+	}
+
+	expires := time.Now().Add(exportLifetime)
+	if err = cfg.writeExport(ctx, export); err != nil {
+		log.Printf("error building data export %s: %s", export.ID, err)
+		if err = cfg.Db.FailDataExport(ctx, database.FailDataExportParams{ExpiresAt: expires, ID: export.ID}); err != nil {
+			log.Printf("error marking data export failed: %s", err)
+		}
+		return true
+	}
+
+	if err = cfg.Db.CompleteDataExport(ctx, database.CompleteDataExportParams{ExpiresAt: expires, ID: export.ID}); err != nil {
+		log.Printf("error marking data export ready: %s", err)
+	}
+	return true
+}
+
+// writeExport gathers the user's data and writes the archive. It goes to a
+// temporary file first so a half written archive is never served.
+func (cfg *apiConfig) writeExport(ctx context.Context, export database.DataExport) error {
+	archive, err := cfg.gatherExport(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(cfg.export_dir, "export-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err = dataexport.Write(f, archive); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), cfg.exportPath(export.ID))
+}
+
+func (cfg *apiConfig) gatherExport(ctx context.Context, userid uuid.UUID) (dataexport.Archive, error) {
+	user, err := cfg.Db.GetUserById(ctx, userid)
+	if err != nil {
+		return dataexport.Archive{}, err
+	}
+	chirps, err := cfg.Db.GetChirpsForUser(ctx, userid)
+	if err != nil {
+		return dataexport.Archive{}, err
+	}
+	revisions, err := cfg.Db.ListUserChirpRevisions(ctx, userid)
+	if err != nil {
+		return dataexport.Archive{}, err
+	}
+	follows, err := cfg.Db.ListUserFollows(ctx, userid)
+	if err != nil {
+		return dataexport.Archive{}, err
+	}
+	likes, err := cfg.Db.ListUserLikes(ctx, userid)
+	if err != nil {
+		return dataexport.Archive{}, err
+	}
+	mentions, err := cfg.Db.ListUserMentions(ctx, userid)
+	if err != nil {
+		return dataexport.Archive{}, err
+	}
+	tokens, err := cfg.Db.ListUserRefreshTokens(ctx, userid)
+	if err != nil {
+		return dataexport.Archive{}, err
+	}
+	pats, err := cfg.Db.ListPersonalAccessTokens(ctx, userid)
+	if err != nil {
+		return dataexport.Archive{}, err
+	}
+	clients, err := cfg.Db.ListOAuthClients(ctx, userid)
+	if err != nil {
+		return dataexport.Archive{}, err
+	}
+	attempts, err := cfg.Db.ListUserLoginAttempts(ctx, database.ListUserLoginAttemptsParams{
+		UserID: uuid.NullUUID{UUID: userid, Valid: true},
+		Email:  user.Email,
+	})
+	if err != nil {
+		return dataexport.Archive{}, err
+	}
+
+	archive := dataexport.Archive{
+		GeneratedAt: time.Now(),
+		Profile: dataexport.Profile{
+			ID:               user.ID,
+			Email:            user.Email,
+			EmailVerified:    user.EmailVerifiedAt.Valid,
+			PendingEmail:     user.PendingEmail.String,
+			Username:         user.Username.String,
+			DisplayName:      user.DisplayName.String,
+			Bio:              user.Bio.String,
+			Location:         user.Location.String,
+			Website:          user.Website.String,
+			Role:             user.Role,
+			TwoFactorEnabled: user.TotpEnabledAt.Valid,
+			CreatedAt:        user.CreatedAt,
+			UpdatedAt:        user.UpdatedAt,
+		},
+		Subscription: dataexport.Subscription{ChirpyRed: user.IsChirpyRed},
+	}
+	for _, chirp := range chirps {
+		archive.Chirps = append(archive.Chirps, dataexport.Chirp{
+			ID:        chirp.ID,
+			Body:      chirp.Body,
+			CreatedAt: chirp.CreatedAt,
+			EditedAt:  timePtr(chirp.EditedAt),
+			InReplyTo: uuidPtr(chirp.InReplyTo),
+			RechirpOf: uuidPtr(chirp.RechirpOf),
+			QuoteOf:   uuidPtr(chirp.QuoteOf),
+		})
+	}
+	for _, revision := range revisions {
+		archive.ChirpRevisions = append(archive.ChirpRevisions, dataexport.ChirpRevision{
+			ChirpID:   revision.ChirpID,
+			Body:      revision.Body,
+			CreatedAt: revision.CreatedAt,
+		})
+	}
+	for _, follow := range follows {
+		if follow.FollowerID == userid {
+			archive.Following = append(archive.Following, dataexport.Follow{UserID: follow.FolloweeID, CreatedAt: follow.CreatedAt})
+		} else {
+			archive.Followers = append(archive.Followers, dataexport.Follow{UserID: follow.FollowerID, CreatedAt: follow.CreatedAt})
+		}
+	}
+	for _, like := range likes {
+		archive.Likes = append(archive.Likes, dataexport.Like{ChirpID: like.ChirpID, CreatedAt: like.CreatedAt})
+	}
+	for _, mention := range mentions {
+		archive.Mentions = append(archive.Mentions, dataexport.Mention{ChirpID: mention.ChirpID, CreatedAt: mention.CreatedAt})
+	}
+	for _, token := range tokens {
+		archive.Sessions = append(archive.Sessions, dataexport.Session{
+			FamilyID:   token.FamilyID,
+			Client:     token.ClientName.String,
+			Scopes:     token.Scopes,
+			UserAgent:  token.UserAgent,
+			IPAddress:  token.IpAddress,
+			CreatedAt:  token.CreatedAt,
+			LastUsedAt: token.LastUsedAt,
+			ExpiresAt:  token.ExpiresAt,
+			RevokedAt:  timePtr(token.RevokedAt),
+		})
+	}
+	for _, pat := range pats {
+		archive.AccessTokens = append(archive.AccessTokens, dataexport.AccessToken{
+			ID:         pat.ID,
+			Name:       pat.Name,
+			Hint:       pat.TokenPrefix,
+			Scopes:     pat.Scopes,
+			CreatedAt:  pat.CreatedAt,
+			ExpiresAt:  timePtr(pat.ExpiresAt),
+			LastUsedAt: timePtr(pat.LastUsedAt),
+		})
+	}
+	for _, client := range clients {
+		archive.OAuthClients = append(archive.OAuthClients, dataexport.OAuthClient{
+			ID:           client.ID,
+			Name:         client.Name,
+			Public:       !client.SecretHash.Valid,
+			RedirectURIs: client.RedirectUris,
+			CreatedAt:    client.CreatedAt,
+		})
+	}
+	for _, attempt := range attempts {
+		archive.LoginAttempts = append(archive.LoginAttempts, dataexport.LoginAttempt{
+			Email:     attempt.Email,
+			IPAddress: attempt.IpAddress,
+			UserAgent: attempt.UserAgent,
+			Outcome:   attempt.Outcome,
+			CreatedAt: attempt.CreatedAt,
+		})
+	}
+	return archive, nil
+}
+
+func (cfg *apiConfig) deleteExpiredExports(ctx context.Context) {
+	expired, err := cfg.Db.DeleteExpiredDataExports(ctx)
+	if err != nil {
+		log.Printf("error deleting expired data exports: %s", err)
+		return
+	}
+	for _, id := range expired {
+		cfg.removeExportFile(id)
+	}
+}
+
+func (cfg *apiConfig) removeExportFile(id uuid.UUID) {
+	if err := os.Remove(cfg.exportPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("error removing data export: %s", err)
+	}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func uuidPtr(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
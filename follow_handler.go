@@ -0,0 +1,189 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+type FollowResponse struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func (cfg *apiConfig) handleFollowUser(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	followeeid, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("error parsing userID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if followeeid == userid {
+		respondWithError(w, http.StatusBadRequest, "users cannot follow themselves")
+		return
+	}
+
+	followee, err := cfg.Db.GetUserById(r.Context(), followeeid)
+	if err != nil || followee.DeleteAfter.Valid {
+		log.Printf("user not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "user does not exist")
+		return
+	}
+
+	if err = cfg.Db.CreateFollow(r.Context(), database.CreateFollowParams{
+		FollowerID: userid,
+		FolloweeID: followeeid,
+	}); err != nil {
+		log.Printf("error following user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't follow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	followeeid, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("error parsing userID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	if err = cfg.Db.DeleteFollow(r.Context(), database.DeleteFollowParams{
+		FollowerID: userid,
+		FolloweeID: followeeid,
+	}); err != nil {
+		log.Printf("error unfollowing user: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't unfollow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleGetFollowers(w http.ResponseWriter, r *http.Request) {
+	userid, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("error parsing userID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	page, err := parseFeedParams(r)
+	if err != nil {
+		log.Printf("error parsing pagination params: %v", err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bound := page.bound()
+	follows, err := cfg.Db.ListFollowers(r.Context(), database.ListFollowersParams{
+		UserID:          userid,
+		CursorCreatedAt: bound.CreatedAt,
+		CursorID:        bound.ID,
+		PageSize:        page.fetchSize(),
+	})
+	if err != nil {
+		log.Printf("error fetching followers: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching followers")
+		return
+	}
+
+	follows, next, _ := paginate(page, follows, func(f database.Follow) pageCursor {
+		return pageCursor{CreatedAt: f.CreatedAt, ID: f.FollowerID}
+	})
+	setPageLinks(w, r, next, nil)
+
+	response := []FollowResponse{}
+	for _, f := range follows {
+		response = append(response, FollowResponse{UserID: f.FollowerID, FollowedAt: f.CreatedAt})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handleGetFollowing(w http.ResponseWriter, r *http.Request) {
+	userid, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("error parsing userID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	page, err := parseFeedParams(r)
+	if err != nil {
+		log.Printf("error parsing pagination params: %v", err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bound := page.bound()
+	follows, err := cfg.Db.ListFollowing(r.Context(), database.ListFollowingParams{
+		UserID:          userid,
+		CursorCreatedAt: bound.CreatedAt,
+		CursorID:        bound.ID,
+		PageSize:        page.fetchSize(),
+	})
+	if err != nil {
+		log.Printf("error fetching followed users: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching followed users")
+		return
+	}
+
+	follows, next, _ := paginate(page, follows, func(f database.Follow) pageCursor {
+		return pageCursor{CreatedAt: f.CreatedAt, ID: f.FolloweeID}
+	})
+	setPageLinks(w, r, next, nil)
+
+	response := []FollowResponse{}
+	for _, f := range follows {
+		response = append(response, FollowResponse{UserID: f.FolloweeID, FollowedAt: f.CreatedAt})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handleGetTimeline(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	page, err := parseFeedParams(r)
+	if err != nil {
+		log.Printf("error parsing pagination params: %v", err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bound := page.bound()
+	chirps, err := cfg.Db.ListTimelineChirps(r.Context(), database.ListTimelineChirpsParams{
+		UserID:          userid,
+		CursorCreatedAt: bound.CreatedAt,
+		CursorID:        bound.ID,
+		PageSize:        page.fetchSize(),
+	})
+	if err != nil {
+		log.Printf("error fetching timeline: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching timeline")
+		return
+	}
+
+	chirps, next, _ := paginate(page, chirps, chirpCursor)
+	setPageLinks(w, r, next, nil)
+
+	response, err := cfg.chirpResponses(r.Context(), chirps, userid)
+	if err != nil {
+		log.Printf("error building chirp responses: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching timeline")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
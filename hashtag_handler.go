@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/zic20/chirpy/internal/chirptext"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+	trendingHashtagsLimit = 10
+)
+
+type TrendingHashtag struct {
+	Tag        string `json:"tag"`
+	ChirpCount int64  `json:"chirp_count"`
+}
+
+// indexChirpHashtags replaces the hashtags stored for chirp with the ones in
+// its current body.
+func (cfg *apiConfig) indexChirpHashtags(ctx context.Context, chirp database.Chirp) error {
+	if err := cfg.Db.DeleteChirpHashtags(ctx, chirp.ID); err != nil {
+		return err
+	}
+
+	tags := chirptext.ExtractHashtags(chirp.Body)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	return cfg.Db.AddChirpHashtags(ctx, database.AddChirpHashtagsParams{
+		Tags:      tags,
+		ChirpID:   chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+	})
+}
+
+func (cfg *apiConfig) handleGetHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := chirptext.NormalizeHashtag(r.PathValue("tag"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "invalid hashtag")
+		return
+	}
+
+	page, err := parseFeedParams(r)
+	if err != nil {
+		log.Printf("error parsing pagination params: %v", err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bound := page.bound()
+	chirps, err := cfg.Db.ListHashtagChirps(r.Context(), database.ListHashtagChirpsParams{
+		Tag:             tag,
+		CursorCreatedAt: bound.CreatedAt,
+		CursorID:        bound.ID,
+		PageSize:        page.fetchSize(),
+	})
+	if err != nil {
+		log.Printf("error fetching hashtag chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching chirps")
+		return
+	}
+
+	chirps, next, _ := paginate(page, chirps, chirpCursor)
+	setPageLinks(w, r, next, nil)
+
+	response, err := cfg.chirpResponses(r.Context(), chirps, cfg.viewerID(r))
+	if err != nil {
+		log.Printf("error building chirp responses: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching chirps")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handleGetTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	window := defaultTrendingWindow
+	if param := r.URL.Query().Get("window"); param != "" {
+		d, err := time.ParseDuration(param)
+		if err != nil || d <= 0 || d > maxTrendingWindow {
+			respondWithError(w, http.StatusBadRequest, "window must be a duration between 0 and 168h")
+			return
+		}
+		window = d
+	}
+
+	trending, err := cfg.Db.ListTrendingHashtags(r.Context(), database.ListTrendingHashtagsParams{
+		Since:   time.Now().UTC().Add(-window),
+		MaxTags: trendingHashtagsLimit,
+	})
+	if err != nil {
+		log.Printf("error fetching trending hashtags: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching trending hashtags")
+		return
+	}
+
+	response := []TrendingHashtag{}
+	for _, t := range trending {
+		response = append(response, TrendingHashtag{Tag: t.Tag, ChirpCount: t.ChirpCount})
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
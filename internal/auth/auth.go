@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"net/http"
@@ -9,12 +10,32 @@ import (
 	"time"
 
 	"github.com/alexedwards/argon2id"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+var hashParams = argon2id.DefaultParams
+
+// SetHashParams changes the argon2id parameters used for new password
+// hashes. It's meant to be called once at startup, before any hashing.
+func SetHashParams(params *argon2id.Params) error {
+	switch {
+	case params.Iterations < 1:
+		return errors.New("argon2id iterations must be at least 1")
+	case params.Parallelism < 1:
+		return errors.New("argon2id parallelism must be at least 1")
+	case params.Memory < 8*uint32(params.Parallelism):
+		return errors.New("argon2id memory must be at least 8 KiB per thread")
+	case params.SaltLength < 16:
+		return errors.New("argon2id salt length must be at least 16 bytes")
+	case params.KeyLength < 16:
+		return errors.New("argon2id key length must be at least 16 bytes")
+	}
+	hashParams = params
+	return nil
+}
+
 func HashPassword(password string) (string, error) {
-	hash, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+	hash, err := argon2id.CreateHash(password, hashParams)
 	if err != nil {
 		return "", err
 	}
@@ -22,6 +43,19 @@ func HashPassword(password string) (string, error) {
 	return hash, nil
 }
 
+// NeedsRehash reports whether hash was made with weaker parameters than the
+// current ones, so it can be replaced the next time the password is known.
+func NeedsRehash(hash string) (bool, error) {
+	params, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false, err
+	}
+	return params.Memory < hashParams.Memory ||
+		params.Iterations < hashParams.Iterations ||
+		params.SaltLength < hashParams.SaltLength ||
+		params.KeyLength < hashParams.KeyLength, nil
+}
+
 func CheckPasswordHash(password, hash string) (bool, error) {
 	match, err := argon2id.ComparePasswordAndHash(password, hash)
 	if err != nil {
@@ -30,23 +64,10 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return match, nil
 }
 
+// MakeJWT signs an HS256 token for a plain user with a shared secret.
+// Deployments with asymmetric keys use KeySet.MakeJWT instead.
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-
-	claims := jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject:   userID.String(),
-	}
-	key := []byte(tokenSecret)
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(key)
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
+	return hmacKeySet(tokenSecret).MakeJWT(userID, RoleUser, expiresIn)
 }
 
 func MakeRefreshToken() (string, error) {
@@ -58,26 +79,45 @@ func MakeRefreshToken() (string, error) {
 	return token, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return uuid.Nil, err
-	}
+const personalAccessTokenPrefix = "chirpy_pat_"
 
-	subject, err := token.Claims.GetSubject()
+// MakePersonalAccessToken returns a new long-lived API token. The fixed
+// prefix tells it apart from a JWT and lets secret scanners spot leaked
+// ones.
+func MakePersonalAccessToken() (string, error) {
+	key, err := MakeRefreshToken()
 	if err != nil {
-		return uuid.Nil, err
+		return "", err
 	}
+	return personalAccessTokenPrefix + key, nil
+}
 
-	id, err := uuid.Parse(subject)
-	if err != nil {
-		return uuid.Nil, err
-	}
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
+
+// PersonalAccessTokenHint returns the start of a token, enough for users to
+// tell their tokens apart without storing the whole thing.
+func PersonalAccessTokenHint(token string) string {
+	n := min(len(token), len(personalAccessTokenPrefix)+8)
+	return token[:n]
+}
 
-	return id, nil
+// HashToken hashes a random token for storage. Unlike passwords these tokens
+// carry enough entropy that a fast hash is safe, and it lets us look them up
+// by hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	return hmacKeySet(tokenSecret).ValidateJWT(tokenString)
+}
 
+func hmacKeySet(tokenSecret string) *KeySet {
+	ks, _ := NewKeySet(DefaultIssuer, DefaultAudience, NewHMACKey(tokenSecret))
+	return ks
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
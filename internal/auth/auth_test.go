@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alexedwards/argon2id"
 	"github.com/google/uuid"
 )
 
@@ -83,3 +84,73 @@ func TestValidateJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Fatalf("expected %q to be recognized as a personal access token", token)
+	}
+
+	jwt, err := MakeJWT(uuid.New(), signature, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsPersonalAccessToken(jwt) {
+		t.Fatalf("expected a JWT not to be recognized as a personal access token")
+	}
+
+	hint := PersonalAccessTokenHint(token)
+	if len(hint) != len(personalAccessTokenPrefix)+8 || token[:len(hint)] != hint {
+		t.Fatalf("unexpected hint %q for %q", hint, token)
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	defer SetHashParams(hashParams)
+
+	weak := &argon2id.Params{Memory: 16 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	strong := &argon2id.Params{Memory: 32 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	if err := SetHashParams(weak); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		key    string
+		params *argon2id.Params
+		rehash bool
+	}{
+		{key: "same params", params: weak},
+		{key: "stronger params", params: strong, rehash: true},
+		{key: "weaker params", params: &argon2id.Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			if err := SetHashParams(c.params); err != nil {
+				t.Fatal(err)
+			}
+			rehash, err := NeedsRehash(hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rehash != c.rehash {
+				t.Fatalf("expected rehash=%v, got %v", c.rehash, rehash)
+			}
+		})
+	}
+
+	if _, err := NeedsRehash("not a hash"); err == nil {
+		t.Fatal("expected an error for a malformed hash")
+	}
+	if err := SetHashParams(&argon2id.Params{Memory: 4, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}); err == nil {
+		t.Fatal("expected an error for too little memory")
+	}
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+)
+
+// maxEmailLength is the longest address SMTP can deliver to (RFC 5321).
+const maxEmailLength = 254
+
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// ValidateEmail checks that email is a bare RFC 5322 addr-spec. Display
+// names, comments and angle brackets are refused so the stored address is
+// exactly what mail gets delivered to.
+func ValidateEmail(email string) error {
+	if email == "" || len(email) > maxEmailLength {
+		return ErrInvalidEmail
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" {
+		return ErrInvalidEmail
+	}
+	// Re-encoding puts quoting back on local parts that need it; anything
+	// else the parser stripped means the input wasn't a bare address.
+	bare := (&mail.Address{Address: addr.Address}).String()
+	if strings.TrimSuffix(strings.TrimPrefix(bare, "<"), ">") != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestValidateEmail(t *testing.T) {
+	cases := []struct {
+		email    string
+		expected error
+	}{
+		{email: "user@example.com", expected: nil},
+		{email: "first.last+tag@sub.example.co.uk", expected: nil},
+		{email: `"quoted local"@example.com`, expected: nil},
+		{email: "", expected: ErrInvalidEmail},
+		{email: "not-an-email", expected: ErrInvalidEmail},
+		{email: "user@", expected: ErrInvalidEmail},
+		{email: "two@@example.com", expected: ErrInvalidEmail},
+		{email: "Bob <bob@example.com>", expected: ErrInvalidEmail},
+		{email: "bob@example.com (Bob)", expected: ErrInvalidEmail},
+		{email: " bob@example.com", expected: ErrInvalidEmail},
+		{email: strings.Repeat("a", 250) + "@example.com", expected: ErrInvalidEmail},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.email), func(t *testing.T) {
+			if err := ValidateEmail(c.email); err != c.expected {
+				t.Fatalf("expected %v, got %v", c.expected, err)
+			}
+		})
+	}
+}
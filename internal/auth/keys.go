@@ -0,0 +1,438 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultIssuer   = "chirpy"
+	DefaultAudience = "chirpy"
+
+	minRSABits = 2048
+)
+
+// Key is a JWT signing key. Keys loaded from a public key file can only
+// verify tokens; they are kept around while tokens signed by a retired key
+// are still in flight.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private any
+	public  any
+}
+
+// NewHMACKey wraps a shared secret as an HS256 key. HMAC keys never appear
+// in the JWKS since publishing them would hand out the signing secret.
+func NewHMACKey(secret string) *Key {
+	sum := sha256.Sum256([]byte(secret))
+	return &Key{
+		ID:      "hs256-" + base64.RawURLEncoding.EncodeToString(sum[:6]),
+		Method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+}
+
+// LoadKey reads a PEM encoded Ed25519 or RSA key from disk. Private keys
+// may be PKCS#8 or PKCS#1, public keys PKIX or PKCS#1.
+func LoadKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+func ParseKeyPEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{}
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.public = jwt.SigningMethodEdDSA, k
+	case *rsa.PrivateKey:
+		key.Method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.public = jwt.SigningMethodRS256, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	if rsaKey, ok := key.public.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+	}
+
+	key.ID, err = key.thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// CanSign reports whether the key holds private material.
+func (k *Key) CanSign() bool {
+	return k.private != nil
+}
+
+// JWK is a public key in the RFC 7517 JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwk returns the public half of the key, or false for symmetric keys.
+func (k *Key) jwk() (JWK, bool) {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+	switch pub := k.public.(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// thumbprint derives the key id from the RFC 7638 JWK thumbprint, so the
+// same key always gets the same kid across restarts and hosts.
+func (k *Key) thumbprint() (string, error) {
+	jwk, ok := k.jwk()
+	if !ok {
+		return "", errors.New("cannot thumbprint a symmetric key")
+	}
+
+	// The required members, in lexicographic order, with no whitespace.
+	var members any
+	switch jwk.KeyType {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// KeySet signs tokens with a single active key and verifies them against
+// every key it holds, which lets keys be rotated without logging everyone
+// out: start signing with the new key and keep the old one for verification
+// until its tokens expire.
+type KeySet struct {
+	Issuer   string
+	Audience string
+	signing  *Key
+	keys     []*Key
+	methods  []string
+}
+
+func NewKeySet(issuer, audience string, signing *Key, verification ...*Key) (*KeySet, error) {
+	if signing == nil || !signing.CanSign() {
+		return nil, errors.New("signing key must include a private key")
+	}
+
+	ks := &KeySet{
+		Issuer:   issuer,
+		Audience: audience,
+		signing:  signing,
+	}
+	for _, key := range append([]*Key{signing}, verification...) {
+		if ks.key(key.ID) != nil {
+			continue
+		}
+		ks.keys = append(ks.keys, key)
+		if !slices.Contains(ks.methods, key.Method.Alg()) {
+			ks.methods = append(ks.methods, key.Method.Alg())
+		}
+	}
+	return ks, nil
+}
+
+// AccessToken is what a validated access token says about its bearer.
+type AccessToken struct {
+	// ID is the jti claim, unique to every token.
+	ID       string
+	UserID   uuid.UUID
+	IssuedAt time.Time
+	// Role is only ever above RoleUser on tokens from the user's own login,
+	// OAuth clients don't get to act with it.
+	Role string
+	// ClientID is only set on tokens issued to OAuth clients, which are
+	// limited to Scopes.
+	ClientID string
+	Scopes   []string
+}
+
+// HasScope reports whether the token grants scope. Tokens from a password
+// login hold every scope.
+func (t AccessToken) HasScope(scope string) bool {
+	return t.ClientID == "" || slices.Contains(t.Scopes, scope)
+}
+
+type accessClaims struct {
+	jwt.RegisteredClaims
+	Role     string `json:"role,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// SigningAlgorithm is the JWS algorithm new tokens are signed with.
+func (ks *KeySet) SigningAlgorithm() string {
+	return ks.signing.Method.Alg()
+}
+
+// MakeJWT issues an access token carrying the user's role, so services that
+// trust our keys can authorize without looking the user up.
+func (ks *KeySet) MakeJWT(userID uuid.UUID, role string, expiresIn time.Duration) (string, error) {
+	if !ValidRole(role) {
+		return "", fmt.Errorf("unknown role %q", role)
+	}
+	return ks.makeJWT(userID, ks.Audience, expiresIn, accessClaims{Role: role})
+}
+
+// MakeScopedJWT issues an access token to an OAuth client that only grants
+// scopes, rather than everything the user could do.
+func (ks *KeySet) MakeScopedJWT(userID uuid.UUID, clientID string, scopes []string, expiresIn time.Duration) (string, error) {
+	if clientID == "" {
+		return "", errors.New("scoped tokens need a client id")
+	}
+	return ks.makeJWT(userID, ks.Audience, expiresIn, accessClaims{
+		Scope:    strings.Join(scopes, " "),
+		ClientID: clientID,
+	})
+}
+
+// MakeChallengeJWT issues a token proving the user got past the password
+// step of a two-factor login.
+func (ks *KeySet) MakeChallengeJWT(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return ks.MakePurposeJWT(userID, PurposeChallenge, expiresIn)
+}
+
+func (ks *KeySet) ValidateChallengeJWT(tokenString string) (uuid.UUID, error) {
+	return ks.ValidatePurposeJWT(tokenString, PurposeChallenge)
+}
+
+// Purposes for single-use-case tokens.
+const (
+	PurposeChallenge = "2fa"
+	PurposeUnlock    = "unlock"
+)
+
+// MakePurposeJWT issues a token that is only good for one purpose, such as
+// unlocking an account. The purpose goes into its own audience so it can
+// never be used as an access token or for any other purpose.
+func (ks *KeySet) MakePurposeJWT(userID uuid.UUID, purpose string, expiresIn time.Duration) (string, error) {
+	return ks.makeJWT(userID, ks.purposeAudience(purpose), expiresIn, accessClaims{})
+}
+
+func (ks *KeySet) ValidatePurposeJWT(tokenString, purpose string) (uuid.UUID, error) {
+	token, err := ks.validateJWT(tokenString, ks.purposeAudience(purpose))
+	return token.UserID, err
+}
+
+func (ks *KeySet) purposeAudience(purpose string) string {
+	return ks.Audience + "/" + purpose
+}
+
+func (ks *KeySet) makeJWT(userID uuid.UUID, audience string, expiresIn time.Duration, claims accessClaims) (string, error) {
+	now := time.Now().UTC()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    ks.Issuer,
+		Audience:  jwt.ClaimStrings{audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		Subject:   userID.String(),
+		ID:        uuid.NewString(),
+	}
+	return ks.sign(claims)
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+	return token.SignedString(ks.signing.private)
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	AuthTime        *jwt.NumericDate `json:"auth_time"`
+	Nonce           string           `json:"nonce,omitempty"`
+	AuthorizedParty string           `json:"azp"`
+}
+
+// MakeIDToken issues an OpenID Connect ID token telling clientID who signed
+// in. OIDC wants the issuer to be the provider's URL, so it is passed in
+// rather than taken from the key set.
+func (ks *KeySet) MakeIDToken(issuer string, userID uuid.UUID, clientID, nonce string, authTime time.Time, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	return ks.sign(idTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		AuthTime:        jwt.NewNumericDate(authTime),
+		Nonce:           nonce,
+		AuthorizedParty: clientID,
+	})
+}
+
+func (ks *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	token, err := ks.ValidateAccessJWT(tokenString)
+	return token.UserID, err
+}
+
+// ValidateAccessJWT validates an access token and returns everything it
+// carries, including the scopes of tokens issued to OAuth clients.
+func (ks *KeySet) ValidateAccessJWT(tokenString string) (AccessToken, error) {
+	return ks.validateJWT(tokenString, ks.Audience)
+}
+
+func (ks *KeySet) validateJWT(tokenString, audience string) (AccessToken, error) {
+	claims := &accessClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, ks.keyFunc,
+		jwt.WithValidMethods(ks.methods),
+		jwt.WithIssuer(ks.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	subject, err := token.Claims.GetSubject()
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	id, err := uuid.Parse(subject)
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	issuedAt, err := token.Claims.GetIssuedAt()
+	if err != nil {
+		return AccessToken{}, err
+	}
+	if issuedAt == nil {
+		return AccessToken{}, errors.New("token has no issued at claim")
+	}
+
+	access := AccessToken{ID: claims.ID, UserID: id, IssuedAt: issuedAt.Time, Role: RoleUser, ClientID: claims.ClientID}
+	if claims.ClientID != "" {
+		access.Scopes = strings.Fields(claims.Scope)
+	} else if claims.Role != "" {
+		access.Role = claims.Role
+	}
+	return access, nil
+}
+
+// keyFunc picks the verification key named by the kid header. The
+// algorithm must match the key's own, otherwise a token could pick a weaker
+// algorithm than the key was issued for.
+func (ks *KeySet) keyFunc(token *jwt.Token) (any, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, errors.New("token has no key id")
+	}
+	key := ks.key(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+	}
+	return key.public, nil
+}
+
+func (ks *KeySet) key(id string) *Key {
+	for _, key := range ks.keys {
+		if key.ID == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// JWKS returns the public keys other services need to verify our tokens.
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if jwk, ok := key.jwk(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func ed25519KeyPEM(t *testing.T) []byte {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func rsaKeyPEM(t *testing.T) []byte {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+}
+
+func TestKeySetRoundTrip(t *testing.T) {
+	cases := []struct {
+		key string
+		pem []byte
+		alg string
+	}{
+		{key: "Ed25519", pem: ed25519KeyPEM(t), alg: "EdDSA"},
+		{key: "RS256", pem: rsaKeyPEM(t), alg: "RS256"},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			key, err := ParseKeyPEM(c.pem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ks, err := NewKeySet(DefaultIssuer, DefaultAudience, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			uid := uuid.New()
+			token, err := ks.MakeJWT(uid, RoleUser, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			userid, err := ks.ValidateJWT(token)
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err.Error())
+			}
+			if userid != uid {
+				t.Fatalf("expected id %s, got %s", uid, userid)
+			}
+
+			jwks := ks.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != key.ID || jwks.Keys[0].Algorithm != c.alg {
+				t.Fatalf("unexpected jwks %+v", jwks)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey, err := ParseKeyPEM(ed25519KeyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := ParseKeyPEM(rsaKeyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, _ := NewKeySet(DefaultIssuer, DefaultAudience, oldKey)
+	token, err := before.MakeJWT(uuid.New(), RoleUser, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, _ := NewKeySet(DefaultIssuer, DefaultAudience, newKey, oldKey)
+	if _, err := rotated.ValidateJWT(token); err != nil {
+		t.Fatalf("expected token from the old key to validate, got: %s", err)
+	}
+	if len(rotated.JWKS().Keys) != 2 {
+		t.Fatalf("expected both keys in the jwks")
+	}
+
+	retired, _ := NewKeySet(DefaultIssuer, DefaultAudience, newKey)
+	if _, err := retired.ValidateJWT(token); err == nil {
+		t.Fatalf("expected token from a retired key to fail")
+	}
+}
+
+func TestKeySetRejects(t *testing.T) {
+	key, err := ParseKeyPEM(ed25519KeyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, _ := NewKeySet(DefaultIssuer, DefaultAudience, key)
+	other, _ := NewKeySet("someone-else", DefaultAudience, key)
+	otherAudience, _ := NewKeySet(DefaultIssuer, "another-service", key)
+
+	sign := func(method jwt.SigningMethod, secret any, kid any) string {
+		token := jwt.NewWithClaims(method, jwt.RegisteredClaims{
+			Issuer:    DefaultIssuer,
+			Audience:  jwt.ClaimStrings{DefaultAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			Subject:   uuid.NewString(),
+		})
+		if kid != nil {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	wrongIssuer, _ := other.MakeJWT(uuid.New(), RoleUser, time.Minute)
+	wrongAudience, _ := otherAudience.MakeJWT(uuid.New(), RoleUser, time.Minute)
+
+	cases := []struct {
+		key   string
+		token string
+	}{
+		{key: "wrong issuer", token: wrongIssuer},
+		{key: "wrong audience", token: wrongAudience},
+		{key: "missing kid", token: sign(jwt.SigningMethodEdDSA, key.private, nil)},
+		{key: "unknown kid", token: sign(jwt.SigningMethodEdDSA, key.private, "nope")},
+		{key: "HS256 with the public key", token: sign(jwt.SigningMethodHS256, []byte(key.public.(ed25519.PublicKey)), key.ID)},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			if _, err := ks.ValidateJWT(c.token); err == nil {
+				t.Fatalf("expected error, got nil (key=%v)", c.key)
+			}
+		})
+	}
+}
+
+func TestParseKeyPEMRejectsSmallRSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	if _, err := ParseKeyPEM(data); err == nil {
+		t.Fatalf("expected 1024 bit RSA key to be rejected")
+	}
+}
+
+func TestChallengeJWT(t *testing.T) {
+	key, err := ParseKeyPEM(ed25519KeyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, _ := NewKeySet(DefaultIssuer, DefaultAudience, key)
+
+	uid := uuid.New()
+	challenge, err := ks.MakeChallengeJWT(uid, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userid, err := ks.ValidateChallengeJWT(challenge)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	if userid != uid {
+		t.Fatalf("expected id %s, got %s", uid, userid)
+	}
+	if _, err := ks.ValidateJWT(challenge); err == nil {
+		t.Fatalf("expected challenge token to be refused as an access token")
+	}
+
+	access, _ := ks.MakeJWT(uid, RoleUser, time.Minute)
+	if _, err := ks.ValidateChallengeJWT(access); err == nil {
+		t.Fatalf("expected access token to be refused as a challenge token")
+	}
+}
+
+func TestScopedJWT(t *testing.T) {
+	key, err := ParseKeyPEM(ed25519KeyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, _ := NewKeySet(DefaultIssuer, DefaultAudience, key)
+	uid := uuid.New()
+
+	scoped, err := ks.MakeScopedJWT(uid, "client-1", []string{"openid", "chirps:read"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full, err := ks.MakeJWT(uid, RoleUser, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		key    string
+		token  string
+		scope  string
+		expect bool
+	}{
+		{key: "granted scope", token: scoped, scope: "chirps:read", expect: true},
+		{key: "missing scope", token: scoped, scope: "chirps:write"},
+		{key: "session scope", token: scoped, scope: ""},
+		{key: "password login holds every scope", token: full, scope: "chirps:write", expect: true},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			access, err := ks.ValidateAccessJWT(c.token)
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err.Error())
+			}
+			if access.UserID != uid {
+				t.Fatalf("expected id %s, got %s", uid, access.UserID)
+			}
+			if access.HasScope(c.scope) != c.expect {
+				t.Fatalf("expected HasScope(%q)=%v", c.scope, c.expect)
+			}
+		})
+	}
+
+	if _, err := ks.MakeScopedJWT(uid, "", []string{"openid"}, time.Minute); err == nil {
+		t.Fatalf("expected scoped token without a client to be refused")
+	}
+}
+
+func TestIDToken(t *testing.T) {
+	key, err := ParseKeyPEM(ed25519KeyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, _ := NewKeySet(DefaultIssuer, DefaultAudience, key)
+	uid := uuid.New()
+
+	token, err := ks.MakeIDToken("https://chirpy.example", uid, "client-1", "n-0S6", time.Now(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.ValidateJWT(token); err == nil {
+		t.Fatalf("expected ID token to be refused as an access token")
+	}
+
+	claims := &idTokenClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, ks.keyFunc,
+		jwt.WithIssuer("https://chirpy.example"),
+		jwt.WithAudience("client-1"),
+	); err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	if claims.Subject != uid.String() || claims.Nonce != "n-0S6" || claims.AuthorizedParty != "client-1" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestRoleClaim(t *testing.T) {
+	key, err := ParseKeyPEM(ed25519KeyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks, _ := NewKeySet(DefaultIssuer, DefaultAudience, key)
+	uid := uuid.New()
+
+	admin, err := ks.MakeJWT(uid, RoleAdmin, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := ks.ValidateAccessJWT(admin)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	if access.Role != RoleAdmin {
+		t.Fatalf("expected role %s, got %s", RoleAdmin, access.Role)
+	}
+
+	scoped, err := ks.MakeScopedJWT(uid, "client-1", []string{"openid"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err = ks.ValidateAccessJWT(scoped)
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err.Error())
+	}
+	if access.Role != RoleUser {
+		t.Fatalf("expected OAuth token to only hold role %s, got %s", RoleUser, access.Role)
+	}
+
+	if _, err := ks.MakeJWT(uid, "root", time.Minute); err == nil {
+		t.Fatalf("expected an unknown role to be refused")
+	}
+}
+
+func TestTokenID(t *testing.T) {
+	ks, _ := NewKeySet(DefaultIssuer, DefaultAudience, NewHMACKey("secret"))
+	uid := uuid.New()
+
+	seen := map[string]bool{}
+	for range 2 {
+		token, err := ks.MakeJWT(uid, RoleUser, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		access, err := ks.ValidateAccessJWT(token)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err.Error())
+		}
+		if access.ID == "" || seen[access.ID] {
+			t.Fatalf("expected a unique token id, got %q", access.ID)
+		}
+		seen[access.ID] = true
+	}
+}
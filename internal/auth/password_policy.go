@@ -0,0 +1,129 @@
+package auth
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MinPasswordLength = 8
+	// Long enough for any passphrase, short enough that hashing it stays
+	// cheap.
+	MaxPasswordLength = 128
+)
+
+// Codes identifying each way a password can break the policy.
+const (
+	PasswordTooShort     = "too_short"
+	PasswordTooLong      = "too_long"
+	PasswordCommon       = "common_password"
+	PasswordRepetitive   = "repetitive"
+	PasswordPersonalInfo = "contains_personal_info"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = loadCommonPasswords(commonPasswordList)
+
+func loadCommonPasswords(list string) map[string]struct{} {
+	passwords := map[string]struct{}{}
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[line] = struct{}{}
+	}
+	return passwords
+}
+
+type PasswordViolation struct {
+	Code    string
+	Message string
+}
+
+// PasswordPolicyError lists every rule a password broke, so users can fix
+// them all at once.
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+// CheckPasswordPolicy returns a *PasswordPolicyError if password is too
+// short or long, a commonly breached password, a single repeated character,
+// or contains one of personal, such as the user's email or username.
+func CheckPasswordPolicy(password string, personal ...string) error {
+	violations := []PasswordViolation{}
+
+	length := utf8.RuneCountInString(password)
+	if length < MinPasswordLength {
+		violations = append(violations, PasswordViolation{PasswordTooShort,
+			fmt.Sprintf("password must be at least %d characters", MinPasswordLength)})
+	}
+	if length > MaxPasswordLength {
+		violations = append(violations, PasswordViolation{PasswordTooLong,
+			fmt.Sprintf("password must be at most %d characters", MaxPasswordLength)})
+	}
+
+	lower := strings.ToLower(password)
+	if isCommonPassword(lower) {
+		violations = append(violations, PasswordViolation{PasswordCommon,
+			"password is too common, it appears in lists of breached passwords"})
+	}
+	if length > 0 && strings.Count(password, string([]rune(password)[:1])) == length {
+		violations = append(violations, PasswordViolation{PasswordRepetitive,
+			"password must not be a single repeated character"})
+	}
+	for _, value := range personal {
+		if containsPersonalInfo(lower, value) {
+			violations = append(violations, PasswordViolation{PasswordPersonalInfo,
+				"password must not contain your email or username"})
+			break
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// isCommonPassword checks the lowercased password against the dictionary,
+// both as is and without the digits and symbols people tack on the end.
+func isCommonPassword(lower string) bool {
+	if _, ok := commonPasswords[lower]; ok {
+		return true
+	}
+	base := strings.TrimRightFunc(lower, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+	if len(base) < 4 {
+		return false
+	}
+	_, ok := commonPasswords[base]
+	return ok
+}
+
+// containsPersonalInfo reports whether the password contains value or, for an
+// email, its local part. Values too short to be telling are ignored.
+func containsPersonalInfo(lower, value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if local, _, ok := strings.Cut(value, "@"); ok {
+		if strings.Contains(lower, value) {
+			return true
+		}
+		value = local
+	}
+	return len(value) >= 4 && strings.Contains(lower, value)
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	cases := []struct {
+		key        string
+		password   string
+		personal   []string
+		violations []string
+	}{
+		{key: "strong passphrase", password: "correct horse battery staple"},
+		{key: "unicode counts runes", password: "pässwörd-ñé"},
+		{key: "too short", password: "x7#kQ", violations: []string{PasswordTooShort}},
+		{key: "too long", password: strings.Repeat("ab", 65), violations: []string{PasswordTooLong}},
+		{key: "common", password: "password", violations: []string{PasswordCommon}},
+		{key: "common any case", password: "LetMeIn", violations: []string{PasswordTooShort, PasswordCommon}},
+		{key: "common with suffix", password: "Dragon2024!", violations: []string{PasswordCommon}},
+		{key: "repeated character", password: "zzzzzzzzzzzz", violations: []string{PasswordRepetitive}},
+		{key: "email local part", password: "walrus-alice-99", personal: []string{"alice@example.com"}, violations: []string{PasswordPersonalInfo}},
+		{key: "username", password: "i-am-bigbird!", personal: []string{"", "BigBird"}, violations: []string{PasswordPersonalInfo}},
+		{key: "short personal values ignored", password: "bob-likes-kites", personal: []string{"bob@example.com"}},
+		{key: "many at once", password: "aaaa", violations: []string{PasswordTooShort, PasswordRepetitive}},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			err := CheckPasswordPolicy(c.password, c.personal...)
+			if len(c.violations) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+				return
+			}
+
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("expected a PasswordPolicyError, got %v", err)
+			}
+			codes := []string{}
+			for _, v := range policyErr.Violations {
+				codes = append(codes, v.Code)
+			}
+			if !slices.Equal(codes, c.violations) {
+				t.Fatalf("expected violations %v, got %v", c.violations, codes)
+			}
+		})
+	}
+}
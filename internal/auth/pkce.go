@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// RFC 7636 verifiers are 43 to 128 unreserved characters. A S256 challenge
+// is always a 43 character base64url SHA-256.
+var (
+	pkceVerifierPattern  = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+	pkceChallengePattern = regexp.MustCompile(`^[A-Za-z0-9\-_]{43}$`)
+)
+
+// PKCEChallenge derives the S256 code challenge for verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func ValidPKCEChallenge(challenge string) bool {
+	return pkceChallengePattern.MatchString(challenge)
+}
+
+// VerifyPKCE checks that verifier is the secret behind an S256 challenge,
+// proving the token request comes from whoever started the authorization.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !pkceVerifierPattern.MatchString(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
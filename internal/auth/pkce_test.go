@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	challenge := PKCEChallenge("dBjftJeZ4CVP-mJ92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if challenge != "ngF5GsXcbwljx6u133FFr3Xht9xooA_DuaX_3QwODtc" {
+		t.Fatalf("unexpected challenge %s", challenge)
+	}
+	if !ValidPKCEChallenge(challenge) {
+		t.Fatalf("expected %s to be a valid challenge", challenge)
+	}
+	if ValidPKCEChallenge("plain-verifier") {
+		t.Fatalf("expected a plain verifier not to pass as a challenge")
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mJ92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := PKCEChallenge(verifier)
+
+	cases := []struct {
+		key      string
+		verifier string
+		expect   bool
+	}{
+		{key: "matching verifier", verifier: verifier, expect: true},
+		{key: "other verifier", verifier: strings.Repeat("a", 43)},
+		{key: "too short", verifier: verifier[:42]},
+		{key: "too long", verifier: strings.Repeat("a", 129)},
+		{key: "invalid characters", verifier: verifier[:42] + "+"},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			if VerifyPKCE(c.verifier, challenge) != c.expect {
+				t.Fatalf("expected %v", c.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package auth
+
+import "slices"
+
+// Roles from least to most privileged. Each role can do everything the ones
+// before it can.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+func ValidRole(role string) bool {
+	return slices.Contains(roles, role)
+}
+
+// HasRole reports whether role grants at least required. Unknown roles grant
+// nothing.
+func HasRole(role, required string) bool {
+	have, want := slices.Index(roles, role), slices.Index(roles, required)
+	return have >= 0 && want >= 0 && have >= want
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHasRole(t *testing.T) {
+	cases := []struct {
+		key      string
+		role     string
+		required string
+		expect   bool
+	}{
+		{key: "user as user", role: RoleUser, required: RoleUser, expect: true},
+		{key: "user as moderator", role: RoleUser, required: RoleModerator},
+		{key: "moderator as user", role: RoleModerator, required: RoleUser, expect: true},
+		{key: "moderator as admin", role: RoleModerator, required: RoleAdmin},
+		{key: "admin as moderator", role: RoleAdmin, required: RoleModerator, expect: true},
+		{key: "unknown role", role: "root", required: RoleUser},
+		{key: "empty role", role: "", required: RoleUser},
+		{key: "unknown requirement", role: RoleAdmin, required: "root"},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			if HasRole(c.role, c.required) != c.expect {
+				t.Fatalf("expected HasRole(%q, %q)=%v", c.role, c.required, c.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA1 test vectors from RFC 6238 appendix B, truncated to six digits.
+func TestTOTPCode(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	cases := []struct {
+		key  int64
+		code string
+	}{
+		{key: 59, code: "287082"},
+		{key: 1111111109, code: "081804"},
+		{key: 1111111111, code: "050471"},
+		{key: 1234567890, code: "005924"},
+		{key: 2000000000, code: "279037"},
+		{key: 20000000000, code: "353130"},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			code, err := TOTPCode(secret, TOTPStep(time.Unix(c.key, 0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != c.code {
+				t.Fatalf("expected code %s, got %s", c.code, code)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+	code := func(step int64) string {
+		c, err := TOTPCode(secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	cases := []struct {
+		key        string
+		code       string
+		lastStep   int64
+		shouldFail bool
+	}{
+		{key: "current step", code: code(step)},
+		{key: "previous step", code: code(step - 1)},
+		{key: "next step", code: code(step + 1)},
+		{key: "too old", code: code(step - 2), shouldFail: true},
+		{key: "replayed", code: code(step), lastStep: step, shouldFail: true},
+		{key: "wrong length", code: "12345", shouldFail: true},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			_, ok := ValidateTOTP(secret, c.code, now, c.lastStep)
+			if ok == c.shouldFail {
+				t.Fatalf("expected valid=%v, got %v", !c.shouldFail, ok)
+			}
+		})
+	}
+}
+
+func TestIsTOTPCode(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range codes {
+		if IsTOTPCode(code) || IsTOTPCode(NormalizeRecoveryCode(code)) {
+			t.Fatalf("recovery code %q taken for a TOTP code", code)
+		}
+	}
+	for _, code := range []string{"123456", " 012345 "} {
+		if !IsTOTPCode(code) {
+			t.Fatalf("expected %q to be a TOTP code", code)
+		}
+	}
+	for _, code := range []string{"12345", "1234567", "12a456"} {
+		if IsTOTPCode(code) {
+			t.Fatalf("expected %q not to be a TOTP code", code)
+		}
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("expected 10 codes, got %d", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("unexpected code format %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+		if NormalizeRecoveryCode(strings.ToUpper(code)) != strings.Replace(code, "-", "", 1) {
+			t.Fatalf("normalizing %q didn't round trip", code)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Package authn authenticates API requests by their bearer token and hands
+// the result to handlers as a Principal in the request context. Failures are
+// answered with the WWW-Authenticate challenges of RFC 6750.
+package authn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/auth"
+)
+
+// Kinds of token a Principal can come from.
+const (
+	KindSession             = "session"
+	KindOAuth               = "oauth"
+	KindPersonalAccessToken = "personal_access_token"
+)
+
+// Principal is the authenticated user behind a request.
+type Principal struct {
+	UserID uuid.UUID
+	Role   string
+	Kind   string
+	// Scopes limits what OAuth and personal access tokens may do. Sessions
+	// from a password login hold every scope.
+	Scopes []string
+	// ClientID is the OAuth client the token was issued to, if any.
+	ClientID string
+	// TokenID identifies the token itself, such as its jti claim.
+	TokenID string
+}
+
+// HasScope reports whether the principal may act within scope. The empty
+// scope stands for managing the account itself, which only sessions can do.
+func (p Principal) HasScope(scope string) bool {
+	return p.Kind == KindSession || (scope != "" && slices.Contains(p.Scopes, scope))
+}
+
+// HasRole reports whether the principal holds at least role. Only sessions
+// carry the user's role, other tokens act as a plain user.
+func (p Principal) HasRole(role string) bool {
+	if p.Kind != KindSession {
+		return role == auth.RoleUser
+	}
+	return auth.HasRole(p.Role, role)
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal the middleware stored, if the request
+// was authenticated.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// Verifier turns a bearer token into a Principal. Errors that aren't an
+// *Error are treated as an invalid token.
+type Verifier interface {
+	Verify(ctx context.Context, token string) (Principal, error)
+}
+
+type VerifierFunc func(ctx context.Context, token string) (Principal, error)
+
+func (f VerifierFunc) Verify(ctx context.Context, token string) (Principal, error) {
+	return f(ctx, token)
+}
+
+// Error codes from RFC 6750 section 3.1.
+const (
+	CodeInvalidRequest    = "invalid_request"
+	CodeInvalidToken      = "invalid_token"
+	CodeInsufficientScope = "insufficient_scope"
+)
+
+// Error is an authentication failure. A request without any credentials
+// gets an Error with no Code, per RFC 6750.
+type Error struct {
+	Code        string
+	Description string
+	// Scope is the scope that was missing, for insufficient_scope.
+	Scope string
+}
+
+func (e *Error) Error() string {
+	return e.Description
+}
+
+func (e *Error) Status() int {
+	switch e.Code {
+	case CodeInvalidRequest:
+		return http.StatusBadRequest
+	case CodeInsufficientScope:
+		return http.StatusForbidden
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+func InvalidToken(description string) *Error {
+	return &Error{Code: CodeInvalidToken, Description: description}
+}
+
+var (
+	errNoToken   = &Error{Description: "authorization header expected"}
+	errForbidden = &Error{Code: CodeInsufficientScope, Description: "user not authorized to perform this action"}
+)
+
+func insufficientScope(scope string) *Error {
+	return &Error{Code: CodeInsufficientScope, Description: "token is missing the required scope", Scope: scope}
+}
+
+// RFC 6750 b64token syntax.
+var tokenPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~+/]+=*$`)
+
+// BearerToken extracts the token from the Authorization header. The scheme
+// is case insensitive; a request using another scheme counts as carrying no
+// token at all.
+func BearerToken(r *http.Request) (string, error) {
+	values := r.Header.Values("Authorization")
+	if len(values) == 0 {
+		return "", errNoToken
+	}
+	if len(values) > 1 {
+		return "", &Error{Code: CodeInvalidRequest, Description: "only one authorization header is allowed"}
+	}
+
+	scheme, token, _ := strings.Cut(values[0], " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", errNoToken
+	}
+	if !tokenPattern.MatchString(token) {
+		return "", &Error{Code: CodeInvalidRequest, Description: "malformed bearer token"}
+	}
+	return token, nil
+}
+
+// Authenticator is the middleware guarding routes.
+type Authenticator struct {
+	Verifier Verifier
+	// Realm is sent back in every challenge.
+	Realm string
+}
+
+func New(verifier Verifier, realm string) *Authenticator {
+	return &Authenticator{Verifier: verifier, Realm: realm}
+}
+
+// Require only lets requests through with a valid token holding scope.
+func (a *Authenticator) Require(scope string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.authenticate(r)
+		if err != nil {
+			a.Challenge(w, err)
+			return
+		}
+		if !p.HasScope(scope) {
+			a.Challenge(w, insufficientScope(scope))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+	})
+}
+
+// Optional lets anonymous requests through as they are, and adds the
+// principal when the token holds scope. A token that is presented but
+// invalid is still refused, so clients find out it has gone bad.
+func (a *Authenticator) Optional(scope string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.authenticate(r)
+		if err == errNoToken {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			a.Challenge(w, err)
+			return
+		}
+		if p.HasScope(scope) {
+			r = r.WithContext(NewContext(r.Context(), p))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireRole only lets through sessions whose user holds at least role.
+func (a *Authenticator) RequireRole(role string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.authenticate(r)
+		if err != nil {
+			a.Challenge(w, err)
+			return
+		}
+		if !p.HasRole(role) {
+			a.Challenge(w, errForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+	})
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (Principal, error) {
+	token, err := BearerToken(r)
+	if err != nil {
+		return Principal{}, err
+	}
+	p, err := a.Verifier.Verify(r.Context(), token)
+	if err != nil {
+		if _, ok := err.(*Error); !ok {
+			log.Printf("error verifying token: %s", err)
+			err = InvalidToken("invalid token")
+		}
+		return Principal{}, err
+	}
+	return p, nil
+}
+
+// Challenge answers a failed authentication with its status, a
+// WWW-Authenticate header and a JSON error body.
+func (a *Authenticator) Challenge(w http.ResponseWriter, err error) {
+	authErr, ok := err.(*Error)
+	if !ok {
+		authErr = InvalidToken("invalid token")
+	}
+
+	challenge := fmt.Sprintf("Bearer realm=%q", a.Realm)
+	if authErr.Code != "" {
+		challenge += fmt.Sprintf(", error=%q, error_description=%q", authErr.Code, authErr.Description)
+	}
+	if authErr.Scope != "" {
+		challenge += fmt.Sprintf(", scope=%q", authErr.Scope)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(authErr.Status())
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{authErr.Description})
+}
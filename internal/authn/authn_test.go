@@ -0,0 +1,189 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/auth"
+)
+
+var (
+	sessionUser = uuid.New()
+	tokenUser   = uuid.New()
+)
+
+// fakeVerifier knows a handful of tokens by name.
+func fakeVerifier() Verifier {
+	return VerifierFunc(func(ctx context.Context, token string) (Principal, error) {
+		switch token {
+		case "session":
+			return Principal{UserID: sessionUser, Role: auth.RoleUser, Kind: KindSession, TokenID: "jti-1"}, nil
+		case "admin":
+			return Principal{UserID: sessionUser, Role: auth.RoleAdmin, Kind: KindSession}, nil
+		case "read-only":
+			return Principal{UserID: tokenUser, Kind: KindPersonalAccessToken, Scopes: []string{"chirps:read"}}, nil
+		case "expired":
+			return Principal{}, InvalidToken("token has expired")
+		default:
+			return Principal{}, errors.New("database is down")
+		}
+	})
+}
+
+// echo reports who the middleware let through.
+func echo(w http.ResponseWriter, r *http.Request) {
+	p, ok := FromContext(r.Context())
+	if !ok {
+		w.Write([]byte("anonymous"))
+		return
+	}
+	w.Write([]byte(p.UserID.String()))
+}
+
+func serve(h http.Handler, authorization ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, a := range authorization {
+		r.Header.Add("Authorization", a)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRequire(t *testing.T) {
+	a := New(fakeVerifier(), "chirpy")
+
+	cases := []struct {
+		key           string
+		scope         string
+		authorization []string
+		status        int
+		challenge     string
+		body          string
+	}{
+		{key: "session", scope: "chirps:write", authorization: []string{"Bearer session"}, status: 200, body: sessionUser.String()},
+		{key: "lowercase scheme", scope: "chirps:write", authorization: []string{"bearer session"}, status: 200, body: sessionUser.String()},
+		{key: "token with scope", scope: "chirps:read", authorization: []string{"Bearer read-only"}, status: 200, body: tokenUser.String()},
+		{key: "no header", scope: "chirps:read", status: 401, challenge: `Bearer realm="chirpy"`},
+		{key: "other scheme", scope: "chirps:read", authorization: []string{"ApiKey abc"}, status: 401, challenge: `Bearer realm="chirpy"`},
+		{
+			key: "malformed token", scope: "chirps:read", authorization: []string{"Bearer not a token"}, status: 400,
+			challenge: `Bearer realm="chirpy", error="invalid_request", error_description="malformed bearer token"`,
+		},
+		{
+			key: "two headers", scope: "chirps:read", authorization: []string{"Bearer session", "Bearer admin"}, status: 400,
+			challenge: `Bearer realm="chirpy", error="invalid_request", error_description="only one authorization header is allowed"`,
+		},
+		{
+			key: "expired", scope: "chirps:read", authorization: []string{"Bearer expired"}, status: 401,
+			challenge: `Bearer realm="chirpy", error="invalid_token", error_description="token has expired"`,
+		},
+		{
+			key: "verifier failure", scope: "chirps:read", authorization: []string{"Bearer unknown"}, status: 401,
+			challenge: `Bearer realm="chirpy", error="invalid_token", error_description="invalid token"`,
+		},
+		{
+			key: "missing scope", scope: "chirps:write", authorization: []string{"Bearer read-only"}, status: 403,
+			challenge: `Bearer realm="chirpy", error="insufficient_scope", error_description="token is missing the required scope", scope="chirps:write"`,
+		},
+		{
+			key: "session scope", scope: "", authorization: []string{"Bearer read-only"}, status: 403,
+			challenge: `Bearer realm="chirpy", error="insufficient_scope", error_description="token is missing the required scope"`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			w := serve(a.Require(c.scope, echo), c.authorization...)
+			if w.Code != c.status {
+				t.Fatalf("expected status %d, got %d", c.status, w.Code)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != c.challenge {
+				t.Fatalf("expected challenge %q, got %q", c.challenge, got)
+			}
+			if c.body != "" && w.Body.String() != c.body {
+				t.Fatalf("expected body %q, got %q", c.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestOptional(t *testing.T) {
+	a := New(fakeVerifier(), "chirpy")
+
+	cases := []struct {
+		key           string
+		scope         string
+		authorization string
+		status        int
+		body          string
+	}{
+		{key: "anonymous", scope: "chirps:read", status: 200, body: "anonymous"},
+		{key: "session", scope: "chirps:read", authorization: "Bearer session", status: 200, body: sessionUser.String()},
+		{key: "token without scope", scope: "chirps:write", authorization: "Bearer read-only", status: 200, body: "anonymous"},
+		{key: "expired", scope: "chirps:read", authorization: "Bearer expired", status: 401},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			var w *httptest.ResponseRecorder
+			if c.authorization == "" {
+				w = serve(a.Optional(c.scope, echo))
+			} else {
+				w = serve(a.Optional(c.scope, echo), c.authorization)
+			}
+			if w.Code != c.status {
+				t.Fatalf("expected status %d, got %d", c.status, w.Code)
+			}
+			if c.body != "" && w.Body.String() != c.body {
+				t.Fatalf("expected body %q, got %q", c.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	a := New(fakeVerifier(), "chirpy")
+
+	cases := []struct {
+		key           string
+		role          string
+		authorization string
+		status        int
+	}{
+		{key: "admin", role: auth.RoleAdmin, authorization: "Bearer admin", status: 200},
+		{key: "admin as moderator", role: auth.RoleModerator, authorization: "Bearer admin", status: 200},
+		{key: "user", role: auth.RoleModerator, authorization: "Bearer session", status: 403},
+		{key: "personal access token", role: auth.RoleModerator, authorization: "Bearer read-only", status: 403},
+		{key: "expired", role: auth.RoleAdmin, authorization: "Bearer expired", status: 401},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			w := serve(a.RequireRole(c.role, echo), c.authorization)
+			if w.Code != c.status {
+				t.Fatalf("expected status %d, got %d", c.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestPrincipalInContext(t *testing.T) {
+	a := New(fakeVerifier(), "chirpy")
+
+	var got Principal
+	h := a.Require("chirps:read", func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	})
+	serve(h, "Bearer session")
+
+	expected := Principal{UserID: sessionUser, Role: auth.RoleUser, Kind: KindSession, TokenID: "jti-1"}
+	if got.UserID != expected.UserID || got.Role != expected.Role || got.Kind != expected.Kind || got.TokenID != expected.TokenID {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+}
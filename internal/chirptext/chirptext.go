@@ -0,0 +1,104 @@
+package chirptext
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+)
+
+const maxHashtagLength = 100
+
+// A hashtag starts with # at the beginning of the text or after a character
+// that can't be part of a word, so "a#b" and "##b" aren't tags.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{N}_#&])#([\p{L}\p{M}\p{N}_]+)`)
+
+// ExtractHashtags returns the normalized hashtags in body, without
+// duplicates and in order of first appearance.
+func ExtractHashtags(body string) []string {
+	tags := []string{}
+	seen := map[string]struct{}{}
+	for _, match := range hashtagPattern.FindAllStringSubmatch(body, -1) {
+		tag := NormalizeHashtag(match[1])
+		if tag == "" {
+			continue
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// NormalizeHashtag case-folds tag and strips a leading #. Tags made up only of
+// digits or longer than maxHashtagLength normalize to "".
+func NormalizeHashtag(tag string) string {
+	tag = strings.TrimPrefix(tag, "#")
+	if tag == "" || len([]rune(tag)) > maxHashtagLength {
+		return ""
+	}
+	if strings.IndexFunc(tag, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+		return ""
+	}
+	return cases.Fold().String(tag)
+}
+
+var (
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,15}$`)
+	mentionPattern  = regexp.MustCompile(`(?:^|[^\p{L}\p{M}\p{N}_@.])@([A-Za-z0-9_]{3,15})\b`)
+)
+
+// reservedUsernames can't be claimed because they collide with routes or
+// could be mistaken for staff accounts.
+var reservedUsernames = map[string]struct{}{
+	"admin":     {},
+	"api":       {},
+	"app":       {},
+	"chirpy":    {},
+	"everyone":  {},
+	"help":      {},
+	"login":     {},
+	"me":        {},
+	"mentions":  {},
+	"moderator": {},
+	"root":      {},
+	"settings":  {},
+	"support":   {},
+	"system":    {},
+}
+
+var (
+	ErrInvalidUsername  = errors.New("usernames must be 3 to 15 letters, digits or underscores")
+	ErrReservedUsername = errors.New("username is reserved")
+)
+
+// ValidateUsername checks that username can be claimed by a user.
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return ErrInvalidUsername
+	}
+	if _, ok := reservedUsernames[strings.ToLower(username)]; ok {
+		return ErrReservedUsername
+	}
+	return nil
+}
+
+// ExtractMentions returns the lowercased usernames mentioned in body,
+// without duplicates and in order of first appearance.
+func ExtractMentions(body string) []string {
+	usernames := []string{}
+	seen := map[string]struct{}{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		username := strings.ToLower(match[1])
+		if _, ok := seen[username]; ok {
+			continue
+		}
+		seen[username] = struct{}{}
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
@@ -0,0 +1,109 @@
+package chirptext
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	cases := []struct {
+		key      string
+		body     string
+		expected []string
+	}{
+		{
+			key:      "no hashtags",
+			body:     "just a regular chirp",
+			expected: []string{},
+		},
+		{
+			key:      "case folded and deduplicated",
+			body:     "#Go is great #go #GO",
+			expected: []string{"go"},
+		},
+		{
+			key:      "unicode tags",
+			body:     "Ich liebe #Straße und #Ελλάδα",
+			expected: []string{"strasse", "ελλάδα"},
+		},
+		{
+			key:      "full unicode case folding",
+			body:     "#STRASSE #Straße #STRAẞE #ΟΔΟΣ #οδος #οδοσ",
+			expected: []string{"strasse", "οδοσ"},
+		},
+		{
+			key:      "punctuation ends a tag",
+			body:     "(#chirpy), #boot_dev!",
+			expected: []string{"chirpy", "boot_dev"},
+		},
+		{
+			key:      "ignores mid-word and numeric tags",
+			body:     "issue#42 #42 ##double",
+			expected: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			tags := ExtractHashtags(c.body)
+			if !slices.Equal(tags, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, tags)
+			}
+		})
+	}
+}
+
+func TestExtractMentions(t *testing.T) {
+	cases := []struct {
+		key      string
+		body     string
+		expected []string
+	}{
+		{
+			key:      "lowercased and deduplicated",
+			body:     "hey @Zic20 and @zic20",
+			expected: []string{"zic20"},
+		},
+		{
+			key:      "punctuation ends a mention",
+			body:     "thanks @boot_dev, (@chirpy_fan)!",
+			expected: []string{"boot_dev", "chirpy_fan"},
+		},
+		{
+			key:      "ignores emails and short names",
+			body:     "mail me at someone@example.com @ab",
+			expected: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			usernames := ExtractMentions(c.body)
+			if !slices.Equal(usernames, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, usernames)
+			}
+		})
+	}
+}
+
+func TestValidateUsername(t *testing.T) {
+	cases := []struct {
+		username string
+		expected error
+	}{
+		{username: "zic20", expected: nil},
+		{username: "ab", expected: ErrInvalidUsername},
+		{username: "has space", expected: ErrInvalidUsername},
+		{username: "a_very_long_username", expected: ErrInvalidUsername},
+		{username: "Admin", expected: ErrReservedUsername},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.username), func(t *testing.T) {
+			if err := ValidateUsername(c.username); err != c.expected {
+				t.Fatalf("expected %v, got %v", c.expected, err)
+			}
+		})
+	}
+}
@@ -7,28 +7,91 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const chirpHasDependents = `-- name: ChirpHasDependents :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps
+    WHERE in_reply_to = $1::uuid OR quote_of = $1::uuid
+)
+`
+
+func (q *Queries) ChirpHasDependents(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, chirpHasDependents, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id,created_at,updated_at,body,user_id)
+INSERT INTO chirps (id,created_at,updated_at,body,user_id,in_reply_to,quote_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
-) RETURNING id, created_at, updated_at, body, user_id
+    $2,
+    $3,
+    $4
+) RETURNING id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, edited_at, rechirp_of, quote_of, search_vector
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	QuoteOf   uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+		arg.QuoteOf,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.EditedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.SearchVector,
+	)
+	return i, err
+}
+
+const createRechirp = `-- name: CreateRechirp :one
+INSERT INTO chirps (id,created_at,updated_at,body,user_id,rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    $1,
+    $2::uuid
+)
+ON CONFLICT (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL DO NOTHING
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, edited_at, rechirp_of, quote_of, search_vector
+`
+
+type CreateRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.UUID
+}
+
+func (q *Queries) CreateRechirp(ctx context.Context, arg CreateRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createRechirp, arg.UserID, arg.RechirpOf)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -36,6 +99,12 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.EditedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.SearchVector,
 	)
 	return i, err
 }
@@ -50,8 +119,60 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteRechirp = `-- name: DeleteRechirp :exec
+DELETE FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2::uuid
+`
+
+type DeleteRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.UUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) error {
+	_, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.RechirpOf)
+	return err
+}
+
+const editChirp = `-- name: EditChirp :one
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+    SELECT gen_random_uuid(), chirps.id, chirps.body, NOW() FROM chirps
+    WHERE chirps.id = $1
+)
+UPDATE chirps
+SET body = $2, edited_at = NOW(), updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, edited_at, rechirp_of, quote_of, search_vector
+`
+
+type EditChirpParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) EditChirp(ctx context.Context, arg EditChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, editChirp, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.EditedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.SearchVector,
+	)
+	return i, err
+}
+
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, edited_at, rechirp_of, quote_of, search_vector FROM chirps
+WHERE deleted_at IS NULL
 `
 
 func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
@@ -69,6 +190,12 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.EditedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.SearchVector,
 		); err != nil {
 			return nil, err
 		}
@@ -84,7 +211,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, edited_at, rechirp_of, quote_of, search_vector FROM chirps
 WHERE id = $1
 `
 
@@ -97,13 +224,115 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.EditedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.SearchVector,
 	)
 	return i, err
 }
 
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.in_reply_to FROM chirps parent
+    WHERE parent.id = (SELECT child.in_reply_to FROM chirps child WHERE child.id = $1::uuid)
+    UNION ALL
+    SELECT chirps.id, chirps.in_reply_to FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.in_reply_to
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, edited_at, rechirp_of, quote_of, search_vector FROM chirps
+WHERE id IN (SELECT id FROM ancestors)
+ORDER BY created_at ASC, id ASC
+`
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.EditedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.SearchVector,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpDescendants = `-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT chirps.id FROM chirps
+    WHERE chirps.in_reply_to = $1::uuid
+    UNION ALL
+    SELECT chirps.id FROM chirps
+    JOIN descendants ON chirps.in_reply_to = descendants.id
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, edited_at, rechirp_of, quote_of, search_vector FROM chirps
+WHERE id IN (SELECT id FROM descendants)
+ORDER BY created_at ASC, id ASC
+`
+
+func (q *Queries) GetChirpDescendants(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpDescendants, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.EditedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.SearchVector,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirpsForUser = `-- name: GetChirpsForUser :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, edited_at, rechirp_of, quote_of, search_vector FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetChirpsForUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
@@ -121,6 +350,12 @@ func (q *Queries) GetChirpsForUser(ctx context.Context, userID uuid.UUID) ([]Chi
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.EditedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.SearchVector,
 		); err != nil {
 			return nil, err
 		}
@@ -134,3 +369,309 @@ func (q *Queries) GetChirpsForUser(ctx context.Context, userID uuid.UUID) ([]Chi
 	}
 	return items, nil
 }
+
+const getRechirp = `-- name: GetRechirp :one
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, edited_at, rechirp_of, quote_of, search_vector FROM chirps
+WHERE user_id = $1 AND rechirp_of = $2::uuid
+`
+
+type GetRechirpParams struct {
+	UserID    uuid.UUID
+	RechirpOf uuid.UUID
+}
+
+func (q *Queries) GetRechirp(ctx context.Context, arg GetRechirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getRechirp, arg.UserID, arg.RechirpOf)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.EditedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+		&i.SearchVector,
+	)
+	return i, err
+}
+
+const getRechirpCounts = `-- name: GetRechirpCounts :many
+SELECT rechirp_of, COUNT(*) AS rechirp_count FROM chirps
+WHERE rechirp_of = ANY($1::uuid[])
+GROUP BY rechirp_of
+`
+
+type GetRechirpCountsRow struct {
+	RechirpOf    uuid.NullUUID
+	RechirpCount int64
+}
+
+func (q *Queries) GetRechirpCounts(ctx context.Context, chirpIds []uuid.UUID) ([]GetRechirpCountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRechirpCounts, pq.Array(chirpIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRechirpCountsRow
+	for rows.Next() {
+		var i GetRechirpCountsRow
+		if err := rows.Scan(
+			&i.RechirpOf,
+			&i.RechirpCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAfter = `-- name: ListChirpsAfter :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at, chirps.edited_at, chirps.rechirp_of, chirps.quote_of, chirps.search_vector FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE (chirps.created_at, chirps.id) > ($1::timestamp, $2::uuid)
+AND ($3::uuid IS NULL OR chirps.user_id = $3)
+AND chirps.deleted_at IS NULL
+AND users.delete_after IS NULL
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT $4
+`
+
+type ListChirpsAfterParams struct {
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	AuthorID        uuid.NullUUID
+	PageSize        int32
+}
+
+// Feeds leave out chirps by accounts waiting to be deleted.
+func (q *Queries) ListChirpsAfter(ctx context.Context, arg ListChirpsAfterParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAfter,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.AuthorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.EditedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.SearchVector,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsBefore = `-- name: ListChirpsBefore :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at, chirps.edited_at, chirps.rechirp_of, chirps.quote_of, chirps.search_vector FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE (chirps.created_at, chirps.id) < ($1::timestamp, $2::uuid)
+AND ($3::uuid IS NULL OR chirps.user_id = $3)
+AND chirps.deleted_at IS NULL
+AND users.delete_after IS NULL
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
+`
+
+type ListChirpsBeforeParams struct {
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	AuthorID        uuid.NullUUID
+	PageSize        int32
+}
+
+func (q *Queries) ListChirpsBefore(ctx context.Context, arg ListChirpsBeforeParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsBefore,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.AuthorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.EditedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.SearchVector,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReplies = `-- name: ListReplies :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, edited_at, rechirp_of, quote_of, search_vector FROM chirps
+WHERE in_reply_to = $1::uuid
+ORDER BY created_at ASC, id ASC
+`
+
+func (q *Queries) ListReplies(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listReplies, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.EditedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.SearchVector,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTimelineChirps = `-- name: ListTimelineChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at, chirps.edited_at, chirps.rechirp_of, chirps.quote_of, chirps.search_vector FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+JOIN users ON users.id = chirps.user_id
+WHERE follows.follower_id = $1
+AND (chirps.created_at, chirps.id) < ($2::timestamp, $3::uuid)
+AND chirps.deleted_at IS NULL
+AND users.delete_after IS NULL
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $4
+`
+
+type ListTimelineChirpsParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt time.Time
+	CursorID        uuid.UUID
+	PageSize        int32
+}
+
+func (q *Queries) ListTimelineChirps(ctx context.Context, arg ListTimelineChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listTimelineChirps,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.EditedAt,
+			&i.RechirpOf,
+			&i.QuoteOf,
+			&i.SearchVector,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tombstoneChirp = `-- name: TombstoneChirp :exec
+WITH revisions AS (
+    DELETE FROM chirp_revisions WHERE chirp_id = $1
+), rechirps AS (
+    DELETE FROM chirps WHERE rechirp_of = $1
+), tags AS (
+    DELETE FROM chirp_hashtags WHERE chirp_id = $1
+), mentioned AS (
+    DELETE FROM mentions WHERE chirp_id = $1
+)
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+// Blanks the chirp and drops everything that came from its text in one
+// statement, so a failure can't leave a tombstone with rechirps, hashtags or
+// mentions still attached.
+func (q *Queries) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirp, id)
+	return err
+}
@@ -7,10 +7,45 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_requested_at = NULL, delete_after = NULL, updated_at = NOW()
+WHERE id = $1 AND delete_after IS NOT NULL
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const confirmUserEmail = `-- name: ConfirmUserEmail :execrows
+UPDATE users
+SET email = $1::text, email_verified_at = NOW(), pending_email = NULL, updated_at = NOW()
+WHERE id = $2 AND (email = $1::text OR pending_email = $1::text)
+`
+
+type ConfirmUserEmailParams struct {
+	Email string
+	ID    uuid.UUID
+}
+
+func (q *Queries) ConfirmUserEmail(ctx context.Context, arg ConfirmUserEmailParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, confirmUserEmail, arg.Email, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users(id,created_at,updated_at,email,hashed_password)
 VALUES (
@@ -20,7 +55,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, location, website, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, deletion_requested_at, delete_after
 `
 
 type CreateUserParams struct {
@@ -38,12 +73,56 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeletionRequestedAt,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
 
+const disableTOTP = `-- name: DisableTOTP :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) DisableTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableTOTP, id)
+	return err
+}
+
+const enableTOTP = `-- name: EnableTOTP :execrows
+UPDATE users
+SET totp_enabled_at = NOW(), totp_last_step = $1, updated_at = NOW()
+WHERE id = $2 AND totp_enabled_at IS NULL AND totp_secret IS NOT NULL
+`
+
+type EnableTOTPParams struct {
+	TotpLastStep int64
+	ID           uuid.UUID
+}
+
+func (q *Queries) EnableTOTP(ctx context.Context, arg EnableTOTPParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enableTOTP, arg.TotpLastStep, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, location, website, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, deletion_requested_at, delete_after FROM users
 WHERE email = $1
 `
 
@@ -57,12 +136,26 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeletionRequestedAt,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
 
 const getUserById = `-- name: GetUserById :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, location, website, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, deletion_requested_at, delete_after FROM users
 WHERE id = $1
 `
 
@@ -76,25 +169,382 @@ func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeletionRequestedAt,
+		&i.DeleteAfter,
+	)
+	return i, err
+}
+
+const getUserByUsername = `-- name: GetUserByUsername :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, location, website, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, deletion_requested_at, delete_after FROM users
+WHERE LOWER(username) = LOWER($1::text)
+`
+
+func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByUsername, username)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeletionRequestedAt,
+		&i.DeleteAfter,
+	)
+	return i, err
+}
+
+const getUserTokenState = `-- name: GetUserTokenState :one
+SELECT tokens_valid_after, delete_after FROM users
+WHERE id = $1
+`
+
+type GetUserTokenStateRow struct {
+	TokensValidAfter sql.NullTime
+	DeleteAfter      sql.NullTime
+}
+
+func (q *Queries) GetUserTokenState(ctx context.Context, id uuid.UUID) (GetUserTokenStateRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokenState, id)
+	var i GetUserTokenStateRow
+	err := row.Scan(
+		&i.TokensValidAfter,
+		&i.DeleteAfter,
+	)
+	return i, err
+}
+
+const listUsersDueForDeletion = `-- name: ListUsersDueForDeletion :many
+SELECT id, email FROM users
+WHERE delete_after <= NOW()
+ORDER BY delete_after
+LIMIT $1
+`
+
+type ListUsersDueForDeletionRow struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) ListUsersDueForDeletion(ctx context.Context, limit int32) ([]ListUsersDueForDeletionRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersDueForDeletion, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUsersDueForDeletionRow
+	for rows.Next() {
+		var i ListUsersDueForDeletionRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :execrows
+UPDATE users
+SET hashed_password = $1::text
+WHERE id = $2 AND hashed_password = $3::text
+`
+
+type RehashUserPasswordParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+// Only swaps the hash if the password hasn't changed since it was checked.
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewHash, arg.ID, arg.OldHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeUserAccessTokens = `-- name: RevokeUserAccessTokens :exec
+UPDATE users
+SET tokens_valid_after = $1::timestamp, updated_at = NOW()
+WHERE id = $2
+`
+
+type RevokeUserAccessTokensParams struct {
+	ValidAfter time.Time
+	ID         uuid.UUID
+}
+
+func (q *Queries) RevokeUserAccessTokens(ctx context.Context, arg RevokeUserAccessTokensParams) error {
+	_, err := q.db.ExecContext(ctx, revokeUserAccessTokens, arg.ValidAfter, arg.ID)
+	return err
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deletion_requested_at = COALESCE(deletion_requested_at, NOW()),
+    delete_after = COALESCE(delete_after, $1::timestamp),
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, location, website, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, deletion_requested_at, delete_after
+`
+
+type ScheduleUserDeletionParams struct {
+	DeleteAfter time.Time
+	ID          uuid.UUID
+}
+
+// Asking again keeps the original schedule.
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.DeleteAfter, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeletionRequestedAt,
+		&i.DeleteAfter,
+	)
+	return i, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, location, website, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, deletion_requested_at, delete_after FROM users
+WHERE (LOWER(username) LIKE $1::text || '%'
+OR LOWER(display_name) LIKE $1::text || '%')
+AND delete_after IS NULL
+ORDER BY LOWER(username) = $1::text DESC, username ASC
+LIMIT $2
+`
+
+type SearchUsersParams struct {
+	Prefix     string
+	MaxResults int32
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, arg.Prefix, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.Username,
+			&i.DisplayName,
+			&i.Bio,
+			&i.Location,
+			&i.Website,
+			&i.TokensValidAfter,
+			&i.TotpSecret,
+			&i.TotpEnabledAt,
+			&i.TotpLastStep,
+			&i.EmailVerifiedAt,
+			&i.PendingEmail,
+			&i.Role,
+			&i.DeletionRequestedAt,
+			&i.DeleteAfter,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setPendingEmail = `-- name: SetPendingEmail :one
+UPDATE users
+SET pending_email = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, location, website, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, deletion_requested_at, delete_after
+`
+
+type SetPendingEmailParams struct {
+	PendingEmail sql.NullString
+	ID           uuid.UUID
+}
+
+func (q *Queries) SetPendingEmail(ctx context.Context, arg SetPendingEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setPendingEmail, arg.PendingEmail, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeletionRequestedAt,
+		&i.DeleteAfter,
+	)
+	return i, err
+}
+
+const setTOTPSecret = `-- name: SetTOTPSecret :execrows
+UPDATE users
+SET totp_secret = $1, updated_at = NOW()
+WHERE id = $2 AND totp_enabled_at IS NULL
+`
+
+type SetTOTPSecretParams struct {
+	TotpSecret sql.NullString
+	ID         uuid.UUID
+}
+
+func (q *Queries) SetTOTPSecret(ctx context.Context, arg SetTOTPSecretParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setTOTPSecret, arg.TotpSecret, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserRole = `-- name: SetUserRole :one
+UPDATE users
+SET role = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, location, website, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, deletion_requested_at, delete_after
+`
+
+type SetUserRoleParams struct {
+	Role string
+	ID   uuid.UUID
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.Role, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeletionRequestedAt,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
 
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2
-WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SET email = $1, hashed_password = $2, username = $3,
+    display_name = $4, bio = $5, location = $6, website = $7
+WHERE id = $8
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, location, website, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, deletion_requested_at, delete_after
 `
 
 type UpdateUserParams struct {
 	Email          string
 	HashedPassword string
+	Username       sql.NullString
+	DisplayName    sql.NullString
+	Bio            sql.NullString
+	Location       sql.NullString
+	Website        sql.NullString
 	ID             uuid.UUID
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Username,
+		arg.DisplayName,
+		arg.Bio,
+		arg.Location,
+		arg.Website,
+		arg.ID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -103,18 +553,67 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Username,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.TokensValidAfter,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.DeletionRequestedAt,
+		&i.DeleteAfter,
 	)
 	return i, err
 }
 
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2
+`
+
+type UpdateUserPasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.HashedPassword, arg.ID)
+	return err
+}
+
 const upgradeToIsChirpyRed = `-- name: UpgradeToIsChirpyRed :exec
 UPDATE users
 SET is_chirpy_red = true, updated_at = NOW()
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, username, display_name, bio, location, website, tokens_valid_after, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, deletion_requested_at, delete_after
 `
 
 func (q *Queries) UpgradeToIsChirpyRed(ctx context.Context, id uuid.UUID) error {
 	_, err := q.db.ExecContext(ctx, upgradeToIsChirpyRed, id)
 	return err
 }
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $1::bigint
+WHERE id = $2 AND totp_last_step < $1::bigint
+`
+
+type UseTOTPStepParams struct {
+	Step int64
+	ID   uuid.UUID
+}
+
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.Step, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
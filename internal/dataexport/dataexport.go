@@ -0,0 +1,188 @@
+// Package dataexport writes the archive a user downloads to see everything
+// Chirpy stores about them: a JSON file per kind of data, and an HTML index
+// that presents the same data to a person.
+package dataexport
+
+import (
+	"archive/zip"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Archive struct {
+	GeneratedAt    time.Time
+	Profile        Profile
+	Subscription   Subscription
+	Chirps         []Chirp
+	ChirpRevisions []ChirpRevision
+	Following      []Follow
+	Followers      []Follow
+	Likes          []Like
+	Mentions       []Mention
+	Sessions       []Session
+	AccessTokens   []AccessToken
+	OAuthClients   []OAuthClient
+	LoginAttempts  []LoginAttempt
+}
+
+type Profile struct {
+	ID               uuid.UUID `json:"id"`
+	Email            string    `json:"email"`
+	EmailVerified    bool      `json:"email_verified"`
+	PendingEmail     string    `json:"pending_email,omitempty"`
+	Username         string    `json:"username,omitempty"`
+	DisplayName      string    `json:"display_name,omitempty"`
+	Bio              string    `json:"bio,omitempty"`
+	Location         string    `json:"location,omitempty"`
+	Website          string    `json:"website,omitempty"`
+	Role             string    `json:"role"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type Subscription struct {
+	ChirpyRed bool `json:"chirpy_red"`
+}
+
+type Chirp struct {
+	ID        uuid.UUID  `json:"id"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	InReplyTo *uuid.UUID `json:"in_reply_to,omitempty"`
+	RechirpOf *uuid.UUID `json:"rechirp_of,omitempty"`
+	QuoteOf   *uuid.UUID `json:"quote_of,omitempty"`
+}
+
+// ChirpRevision is an earlier version of an edited chirp.
+type ChirpRevision struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Follow is the other user in a follow, whichever side they're on.
+type Follow struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Like struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Mention is a chirp that mentions the user.
+type Mention struct {
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Session is one refresh token, every rotation of a login shows up. Sessions
+// with a Client are grants to an OAuth app.
+type Session struct {
+	FamilyID   uuid.UUID  `json:"session_id"`
+	Client     string     `json:"client,omitempty"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// AccessToken is a personal access token. The token itself is never stored,
+// only the hint it's shown with.
+type AccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"token_hint"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// OAuthClient is an app the user registered.
+type OAuthClient struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	Public       bool      `json:"public"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type LoginAttempt struct {
+	Email     string    `json:"email"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Outcome   string    `json:"outcome"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+//go:embed index.html.tmpl
+var indexSource string
+
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 MST") },
+	"join": strings.Join,
+}).Parse(indexSource))
+
+// Write writes the archive as a ZIP to w.
+func Write(w io.Writer, a Archive) error {
+	z := zip.NewWriter(w)
+
+	for _, file := range []struct {
+		name string
+		data any
+	}{
+		{"profile.json", a.Profile},
+		{"subscription.json", a.Subscription},
+		{"chirps.json", nonNil(a.Chirps)},
+		{"chirp_revisions.json", nonNil(a.ChirpRevisions)},
+		{"following.json", nonNil(a.Following)},
+		{"followers.json", nonNil(a.Followers)},
+		{"likes.json", nonNil(a.Likes)},
+		{"mentions.json", nonNil(a.Mentions)},
+		{"sessions.json", nonNil(a.Sessions)},
+		{"access_tokens.json", nonNil(a.AccessTokens)},
+		{"oauth_clients.json", nonNil(a.OAuthClients)},
+		{"login_attempts.json", nonNil(a.LoginAttempts)},
+	} {
+		f, err := z.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: a.GeneratedAt})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	f, err := z.CreateHeader(&zip.FileHeader{Name: "index.html", Method: zip.Deflate, Modified: a.GeneratedAt})
+	if err != nil {
+		return err
+	}
+	if err = indexTemplate.Execute(f, a); err != nil {
+		return err
+	}
+
+	return z.Close()
+}
+
+// nonNil keeps empty lists as [] rather than null in the JSON.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,125 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func readArchive(t *testing.T, a Archive) map[string]string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := Write(buf, a); err != nil {
+		t.Fatal(err)
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{}
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(data)
+	}
+	return files
+}
+
+func TestWrite(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	original := uuid.New()
+	follower := uuid.New()
+	a := Archive{
+		GeneratedAt:  now,
+		Profile:      Profile{ID: uuid.New(), Email: "walt@example.com", Role: "user", CreatedAt: now},
+		Subscription: Subscription{ChirpyRed: true},
+		Chirps: []Chirp{
+			{ID: uuid.New(), Body: "<script>alert(1)</script>", CreatedAt: now},
+			{ID: uuid.New(), CreatedAt: now, RechirpOf: &original},
+		},
+		ChirpRevisions: []ChirpRevision{
+			{ChirpID: original, Body: "first draft", CreatedAt: now},
+		},
+		Followers: []Follow{
+			{UserID: follower, CreatedAt: now},
+		},
+		Sessions: []Session{
+			{FamilyID: uuid.New(), UserAgent: "curl/8.0", IPAddress: "127.0.0.1", CreatedAt: now, LastUsedAt: now, ExpiresAt: now.Add(time.Hour), RevokedAt: &now},
+			{FamilyID: uuid.New(), Client: "Feed Reader", UserAgent: "reader/2.0", Scopes: []string{"chirps:read", "profile:read"}, CreatedAt: now, LastUsedAt: now, ExpiresAt: now.Add(time.Hour)},
+		},
+		AccessTokens: []AccessToken{
+			{ID: uuid.New(), Name: "backup script", Hint: "chirpy_pat_abcd1234", Scopes: []string{"chirps:read"}, CreatedAt: now},
+		},
+		LoginAttempts: []LoginAttempt{
+			{Email: "walt@example.com", IPAddress: "10.0.0.1", Outcome: "bad_credentials", CreatedAt: now},
+		},
+	}
+	files := readArchive(t, a)
+
+	cases := []struct {
+		key      string
+		file     string
+		contains string
+	}{
+		{key: "profile", file: "profile.json", contains: `"email": "walt@example.com"`},
+		{key: "subscription", file: "subscription.json", contains: `"chirpy_red": true`},
+		{key: "sessions", file: "sessions.json", contains: `"user_agent": "curl/8.0"`},
+		{key: "index escapes chirps", file: "index.html", contains: "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{key: "index rechirps", file: "index.html", contains: "Rechirp of " + original.String()},
+		{key: "index sessions", file: "index.html", contains: "revoked 2025-01-01 12:00 UTC"},
+		{key: "chirp revisions", file: "chirp_revisions.json", contains: `"body": "first draft"`},
+		{key: "followers", file: "followers.json", contains: follower.String()},
+		{key: "oauth grants", file: "sessions.json", contains: `"chirps:read"`},
+		{key: "access tokens", file: "access_tokens.json", contains: `"token_hint": "chirpy_pat_abcd1234"`},
+		{key: "login attempts", file: "login_attempts.json", contains: `"outcome": "bad_credentials"`},
+		{key: "index grants", file: "index.html", contains: "Feed Reader: reader/2.0 (chirps:read, profile:read)"},
+		{key: "index access tokens", file: "index.html", contains: "backup script"},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			data, ok := files[c.file]
+			if !ok {
+				t.Fatalf("expected %s in the archive", c.file)
+			}
+			if !strings.Contains(data, c.contains) {
+				t.Fatalf("expected %s to contain %q, got:\n%s", c.file, c.contains, data)
+			}
+		})
+	}
+
+	var chirps []Chirp
+	if err := json.Unmarshal([]byte(files["chirps.json"]), &chirps); err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != 2 || chirps[0].Body != a.Chirps[0].Body {
+		t.Fatalf("expected the chirps to round trip, got %+v", chirps)
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	files := readArchive(t, Archive{GeneratedAt: time.Now()})
+	for _, name := range []string{
+		"chirps.json", "chirp_revisions.json", "following.json", "followers.json", "likes.json",
+		"mentions.json", "sessions.json", "access_tokens.json", "oauth_clients.json", "login_attempts.json",
+	} {
+		if strings.TrimSpace(files[name]) != "[]" {
+			t.Fatalf("expected %s to be an empty list, got %q", name, files[name])
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Package loginguard slows down password guessing. Failed attempts are
+// counted per key, such as an account or an IP address; past a few free
+// attempts each further one has to wait exponentially longer, and keys with a
+// lockout policy get locked outright.
+package loginguard
+
+import (
+	"context"
+	"time"
+)
+
+// Attempts is what a Store remembers about a key.
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Store persists attempts. Implementations must make AddFailure atomic so
+// concurrent guesses can't slip past the count.
+type Store interface {
+	// Get returns the attempts for key, or zero Attempts if there are none.
+	Get(ctx context.Context, key string) (Attempts, error)
+	// AddFailure counts a failure at now. A last failure before resetBefore
+	// has expired, so counting starts over.
+	AddFailure(ctx context.Context, key string, now, resetBefore time.Time) (Attempts, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type Policy struct {
+	// FreeAttempts failures are allowed before any delay is imposed.
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure past FreeAttempts; it
+	// doubles with every failure after that, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter failures lock the key for LockoutDuration. Zero never
+	// locks.
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// Window is how long a failure is remembered.
+	Window time.Duration
+}
+
+// Verdict says whether an attempt may go ahead.
+type Verdict struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (v Verdict) Allowed() bool {
+	return !v.Locked && v.RetryAfter <= 0
+}
+
+type Guard struct {
+	Store  Store
+	Policy Policy
+	// Now is the clock, tests swap it out.
+	Now func() time.Time
+}
+
+func New(store Store, policy Policy) *Guard {
+	return &Guard{Store: store, Policy: policy, Now: time.Now}
+}
+
+// Check reports whether key may attempt a login now.
+func (g *Guard) Check(ctx context.Context, key string) (Verdict, error) {
+	a, err := g.Store.Get(ctx, key)
+	if err != nil {
+		return Verdict{}, err
+	}
+	return g.verdict(a, g.Now()), nil
+}
+
+// Fail records a failed attempt for key and returns the verdict for the
+// next one. Locked is set when this failure triggered or extended a lockout.
+func (g *Guard) Fail(ctx context.Context, key string) (Verdict, error) {
+	now := g.Now()
+	a, err := g.Store.AddFailure(ctx, key, now, now.Add(-g.Policy.Window))
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	if g.Policy.LockoutAfter > 0 && a.Failures >= g.Policy.LockoutAfter {
+		a.LockedUntil = now.Add(g.Policy.LockoutDuration)
+		if err = g.Store.Lock(ctx, key, a.LockedUntil); err != nil {
+			return Verdict{}, err
+		}
+	}
+	return g.verdict(a, now), nil
+}
+
+// Reset forgets the failures for key, after a successful login or an
+// unlock.
+func (g *Guard) Reset(ctx context.Context, key string) error {
+	return g.Store.Reset(ctx, key)
+}
+
+func (g *Guard) verdict(a Attempts, now time.Time) Verdict {
+	if a.LockedUntil.After(now) {
+		return Verdict{Locked: true, RetryAfter: a.LockedUntil.Sub(now)}
+	}
+	if a.LastFailure.Before(now.Add(-g.Policy.Window)) {
+		return Verdict{}
+	}
+
+	delay := g.delay(a.Failures)
+	if wait := a.LastFailure.Add(delay).Sub(now); wait > 0 {
+		return Verdict{RetryAfter: wait}
+	}
+	return Verdict{}
+}
+
+// delay is how long to wait after the given number of failures.
+func (g *Guard) delay(failures int) time.Duration {
+	extra := failures - g.Policy.FreeAttempts
+	if extra <= 0 {
+		return 0
+	}
+	delay := g.Policy.BaseDelay
+	for i := 1; i < extra && delay < g.Policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, g.Policy.MaxDelay)
+}
@@ -0,0 +1,112 @@
+package loginguard
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        10 * time.Second,
+	LockoutAfter:    8,
+	LockoutDuration: time.Hour,
+	Window:          24 * time.Hour,
+}
+
+func newTestGuard() (*Guard, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := New(NewMemoryStore(), testPolicy)
+	g.Now = func() time.Time { return now }
+	return g, &now
+}
+
+func TestGuardBackoff(t *testing.T) {
+	cases := []struct {
+		failures int
+		expected Verdict
+	}{
+		{failures: 0, expected: Verdict{}},
+		{failures: 3, expected: Verdict{}},
+		{failures: 4, expected: Verdict{RetryAfter: time.Second}},
+		{failures: 5, expected: Verdict{RetryAfter: 2 * time.Second}},
+		{failures: 6, expected: Verdict{RetryAfter: 4 * time.Second}},
+		{failures: 7, expected: Verdict{RetryAfter: 8 * time.Second}},
+		{failures: 8, expected: Verdict{Locked: true, RetryAfter: time.Hour}},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.failures), func(t *testing.T) {
+			g, _ := newTestGuard()
+			ctx := context.Background()
+			for range c.failures {
+				if _, err := g.Fail(ctx, "account"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			verdict, err := g.Check(ctx, "account")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verdict != c.expected {
+				t.Fatalf("expected %+v, got %+v", c.expected, verdict)
+			}
+		})
+	}
+}
+
+func TestGuardMaxDelay(t *testing.T) {
+	g, _ := newTestGuard()
+	g.Policy.LockoutAfter = 0
+	ctx := context.Background()
+	for range 20 {
+		g.Fail(ctx, "ip")
+	}
+	verdict, _ := g.Check(ctx, "ip")
+	if verdict.Locked || verdict.RetryAfter != testPolicy.MaxDelay {
+		t.Fatalf("expected a %s delay without lockout, got %+v", testPolicy.MaxDelay, verdict)
+	}
+}
+
+func TestGuardRecovers(t *testing.T) {
+	g, now := newTestGuard()
+	ctx := context.Background()
+	for range 5 {
+		g.Fail(ctx, "account")
+	}
+
+	*now = now.Add(2 * time.Second)
+	if verdict, _ := g.Check(ctx, "account"); !verdict.Allowed() {
+		t.Fatalf("expected attempt to be allowed once the delay passed, got %+v", verdict)
+	}
+
+	// Failures outside the window are forgotten.
+	*now = now.Add(testPolicy.Window + time.Second)
+	verdict, _ := g.Fail(ctx, "account")
+	if !verdict.Allowed() {
+		t.Fatalf("expected old failures to be forgotten, got %+v", verdict)
+	}
+
+	for range 10 {
+		g.Fail(ctx, "account")
+	}
+	if err := g.Reset(ctx, "account"); err != nil {
+		t.Fatal(err)
+	}
+	if verdict, _ := g.Check(ctx, "account"); !verdict.Allowed() {
+		t.Fatalf("expected reset to unlock, got %+v", verdict)
+	}
+}
+
+func TestGuardKeysAreIndependent(t *testing.T) {
+	g, _ := newTestGuard()
+	ctx := context.Background()
+	for range 10 {
+		g.Fail(ctx, "account:a@example.com")
+	}
+	if verdict, _ := g.Check(ctx, "account:b@example.com"); !verdict.Allowed() {
+		t.Fatalf("expected other accounts to be unaffected, got %+v", verdict)
+	}
+}
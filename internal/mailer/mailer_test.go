@@ -0,0 +1,106 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageBytes(t *testing.T) {
+	cases := []struct {
+		key        string
+		msg        Message
+		shouldFail bool
+	}{
+		{
+			key: "plain message",
+			msg: Message{To: "user@example.com", Subject: "Reset your password", Body: "line one\nline two"},
+		},
+		{
+			key:        "header injection",
+			msg:        Message{To: "user@example.com\r\nBcc: victim@example.com", Subject: "hi"},
+			shouldFail: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			data, err := c.msg.bytes("chirpy@example.com", time.Unix(0, 0))
+			if c.shouldFail {
+				if err == nil {
+					t.Fatalf("expected error, got nil (key=%v)", c.key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got: %s", err.Error())
+			}
+
+			text := string(data)
+			for _, want := range []string{"From: chirpy@example.com\r\n", "To: user@example.com\r\n", "Subject: Reset your password\r\n", "\r\n\r\nline one\r\nline two"} {
+				if !strings.Contains(text, want) {
+					t.Fatalf("expected message to contain %q, got:\n%s", want, text)
+				}
+			}
+		})
+	}
+}
+
+func TestSMTPMailerGivesUp(t *testing.T) {
+	// A relay that accepts the connection and never says anything.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	m := &SMTPMailer{Addr: l.Addr().String(), From: "chirpy@example.com"}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Send(ctx, Message{To: "user@example.com", Subject: "hi", Body: "hello"})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the deadline to be exceeded, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send didn't give up when the context ended")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: "chirpy@example.com"}
+
+	for range 2 {
+		if err := m.Send(context.Background(), Message{To: "user@example.com", Subject: "hi", Body: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(entries))
+	}
+}
@@ -0,0 +1,46 @@
+package signedurl
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	signer := New([]byte("secret"))
+	signer.Now = func() time.Time { return now }
+
+	link := signer.Sign("/api/exports/1/download", now.Add(time.Hour))
+
+	cases := []struct {
+		key      string
+		link     string
+		at       time.Time
+		expected error
+	}{
+		{key: "valid", link: link, at: now},
+		{key: "extra query", link: link + "&download=1", at: now},
+		{key: "expired", link: link, at: now.Add(time.Hour), expected: ErrExpired},
+		{key: "other path", link: strings.Replace(link, "/1/", "/2/", 1), at: now, expected: ErrInvalidSignature},
+		{key: "later expiry", link: strings.Replace(link, fmt.Sprint(now.Add(time.Hour).Unix()), fmt.Sprint(now.Add(48*time.Hour).Unix()), 1), at: now, expected: ErrInvalidSignature},
+		{key: "other key", link: New([]byte("other")).Sign("/api/exports/1/download", now.Add(time.Hour)), at: now, expected: ErrInvalidSignature},
+		{key: "unsigned", link: "/api/exports/1/download", at: now, expected: ErrInvalidSignature},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Test case: %v", c.key), func(t *testing.T) {
+			now = c.at
+			u, err := url.Parse(c.link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = signer.Verify(u); !errors.Is(err, c.expected) {
+				t.Fatalf("expected %v, got %v", c.expected, err)
+			}
+		})
+	}
+}
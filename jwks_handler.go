@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/zic20/chirpy/internal/auth"
+)
+
+func (cfg *apiConfig) handleGetJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.jwt_keys.JWKS())
+}
+
+// loadKeySet builds the token key set from the environment. JWT_SIGNING_KEY
+// names the PEM file of the active Ed25519 or RSA key and
+// JWT_VERIFICATION_KEYS a comma separated list of keys that are being
+// rotated out. Without a signing key we fall back to HS256 with
+// TOKEN_SIGNATURE, which other services can't verify.
+func loadKeySet() (*auth.KeySet, error) {
+	issuer := envOr("JWT_ISSUER", auth.DefaultIssuer)
+	audience := envOr("JWT_AUDIENCE", auth.DefaultAudience)
+
+	path := os.Getenv("JWT_SIGNING_KEY")
+	if path == "" {
+		return auth.NewKeySet(issuer, audience, auth.NewHMACKey(os.Getenv("TOKEN_SIGNATURE")))
+	}
+
+	signing, err := auth.LoadKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var verification []*auth.Key
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFICATION_KEYS"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		key, err := auth.LoadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		verification = append(verification, key)
+	}
+
+	return auth.NewKeySet(issuer, audience, signing, verification...)
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handleLikeChirp(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("error parsing chirpID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id")
+		return
+	}
+
+	chirp, err := cfg.Db.GetChirp(r.Context(), chirpid)
+	if err != nil || chirp.DeletedAt.Valid {
+		log.Printf("chirp not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+
+	if err = cfg.Db.CreateLike(r.Context(), database.CreateLikeParams{
+		UserID:  userid,
+		ChirpID: chirp.ID,
+	}); err != nil {
+		log.Printf("error liking chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't like chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleUnlikeChirp(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("error parsing chirpID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id")
+		return
+	}
+
+	if err = cfg.Db.DeleteLike(r.Context(), database.DeleteLikeParams{
+		UserID:  userid,
+		ChirpID: chirpid,
+	}); err != nil {
+		log.Printf("error unliking chirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't unlike chirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleGetUserLikes(w http.ResponseWriter, r *http.Request) {
+	userid, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("error parsing userID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	page, err := parseFeedParams(r)
+	if err != nil {
+		log.Printf("error parsing pagination params: %v", err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bound := page.bound()
+	likes, err := cfg.Db.ListLikedChirps(r.Context(), database.ListLikedChirpsParams{
+		UserID:          userid,
+		CursorCreatedAt: bound.CreatedAt,
+		CursorID:        bound.ID,
+		PageSize:        page.fetchSize(),
+	})
+	if err != nil {
+		log.Printf("error fetching liked chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching liked chirps")
+		return
+	}
+
+	likes, next, _ := paginate(page, likes, func(like database.ListLikedChirpsRow) pageCursor {
+		return pageCursor{CreatedAt: like.LikedAt, ID: like.Chirp.ID}
+	})
+	setPageLinks(w, r, next, nil)
+
+	chirps := make([]database.Chirp, 0, len(likes))
+	for _, like := range likes {
+		chirps = append(chirps, like.Chirp)
+	}
+
+	response, err := cfg.chirpResponses(r.Context(), chirps, cfg.viewerID(r))
+	if err != nil {
+		log.Printf("error building chirp responses: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching liked chirps")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/database"
+	"github.com/zic20/chirpy/internal/loginguard"
+	"github.com/zic20/chirpy/internal/mailer"
+)
+
+// Accounts get a handful of guesses before slowing down and are locked after
+// ten. IPs only ever slow down, so an attacker can't lock a whole office
+// out, but they get more room since many users may share one.
+var (
+	accountLoginPolicy = loginguard.Policy{
+		FreeAttempts:    5,
+		BaseDelay:       2 * time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: time.Hour,
+		Window:          24 * time.Hour,
+	}
+	ipLoginPolicy = loginguard.Policy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	}
+)
+
+// throttleSweepInterval is how often expired login_throttle rows are cleared
+// out.
+const throttleSweepInterval = time.Hour
+
+// Outcomes recorded in login_attempts.
+const (
+	outcomeSucceeded            = "success"
+	outcomeSecondFactorRequired = "second_factor_required"
+	outcomeBadCredentials       = "bad_credentials"
+	outcomeBadSecondFactor      = "bad_second_factor"
+	outcomeThrottled            = "throttled"
+	outcomeLocked               = "locked"
+)
+
+// dbThrottleStore keeps login attempts in Postgres so every instance sees
+// the same counts.
+type dbThrottleStore struct {
+	db *database.Queries
+}
+
+func (s dbThrottleStore) Get(ctx context.Context, key string) (loginguard.Attempts, error) {
+	row, err := s.db.GetLoginThrottle(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return loginguard.Attempts{}, nil
+	}
+	if err != nil {
+		return loginguard.Attempts{}, err
+	}
+	return throttleAttempts(row), nil
+}
+
+func (s dbThrottleStore) AddFailure(ctx context.Context, key string, now, resetBefore time.Time) (loginguard.Attempts, error) {
+	row, err := s.db.AddLoginFailure(ctx, database.AddLoginFailureParams{
+		ThrottleKey: key,
+		FailedAt:    now,
+		ResetBefore: resetBefore,
+	})
+	if err != nil {
+		return loginguard.Attempts{}, err
+	}
+	return throttleAttempts(row), nil
+}
+
+func (s dbThrottleStore) Lock(ctx context.Context, key string, until time.Time) error {
+	return s.db.LockLoginThrottle(ctx, database.LockLoginThrottleParams{
+		LockedUntil: sql.NullTime{Time: until, Valid: true},
+		ThrottleKey: key,
+	})
+}
+
+func (s dbThrottleStore) Reset(ctx context.Context, key string) error {
+	return s.db.DeleteLoginThrottle(ctx, key)
+}
+
+// runThrottleSweeper deletes throttle rows that no longer count for anything
+// until ctx is done. Every key gets one, including the ones for emails
+// without an account, so the table would otherwise only grow.
+func (cfg *apiConfig) runThrottleSweeper(ctx context.Context, interval time.Duration) {
+	// A row is only stale once it's past the longest window of any guard
+	// sharing the table.
+	var window time.Duration
+	for _, guard := range []*loginguard.Guard{cfg.account_guard, cfg.ip_guard, cfg.mail_account_guard, cfg.mail_ip_guard} {
+		window = max(window, guard.Policy.Window)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deleted, err := cfg.Db.DeleteStaleLoginThrottles(ctx, time.Now().Add(-window))
+		if err != nil {
+			log.Printf("error deleting stale login throttles: %s", err)
+		} else if deleted > 0 {
+			log.Printf("deleted %d stale login throttles", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func throttleAttempts(row database.LoginThrottle) loginguard.Attempts {
+	return loginguard.Attempts{
+		Failures:    int(row.Failures),
+		LastFailure: row.LastFailureAt,
+		LockedUntil: row.LockedUntil.Time,
+	}
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipThrottleKey(r *http.Request) string {
+	return "ip:" + clientIP(r)
+}
+
+// checkLoginThrottle answers with 423 or 429 and returns false when the
+// account or the client's IP has to wait before trying again.
+func (cfg *apiConfig) checkLoginThrottle(w http.ResponseWriter, r *http.Request, email string) bool {
+	verdict := cfg.loginThrottle(r, email)
+	if verdict.Allowed() {
+		return true
+	}
+	status, msg := throttleResponse(w, verdict)
+	respondWithError(w, status, msg)
+	return false
+}
+
+// loginThrottle returns the verdict of whichever of the client's IP and the
+// account has to wait, recording the refused attempt.
+func (cfg *apiConfig) loginThrottle(r *http.Request, email string) loginguard.Verdict {
+	for _, check := range []struct {
+		guard *loginguard.Guard
+		key   string
+	}{
+		{cfg.ip_guard, ipThrottleKey(r)},
+		{cfg.account_guard, accountThrottleKey(email)},
+	} {
+		verdict, err := check.guard.Check(r.Context(), check.key)
+		if err != nil {
+			// Fail open, a throttle outage shouldn't stop everyone logging in.
+			log.Printf("error checking login throttle: %s", err)
+			continue
+		}
+		if verdict.Allowed() {
+			continue
+		}
+
+		outcome := outcomeThrottled
+		if verdict.Locked {
+			outcome = outcomeLocked
+		}
+		cfg.recordLoginAttempt(r, email, uuid.Nil, outcome)
+		return verdict
+	}
+	return loginguard.Verdict{}
+}
+
+// throttleResponse sets Retry-After and picks the status and message for a
+// refused login.
+func throttleResponse(w http.ResponseWriter, verdict loginguard.Verdict) (int, string) {
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(verdict.RetryAfter.Seconds()))))
+	if verdict.Locked {
+		return http.StatusLocked, "account is temporarily locked, check your email to unlock it"
+	}
+	return http.StatusTooManyRequests, "too many failed login attempts, try again later"
+}
+
+// loginFailed counts a failed attempt against the account and IP, and mails
+// the owner an unlock link when it locks the account.
+func (cfg *apiConfig) loginFailed(r *http.Request, email string, user *database.User, outcome string) {
+	userid := uuid.Nil
+	if user != nil {
+		userid = user.ID
+	}
+	cfg.recordLoginAttempt(r, email, userid, outcome)
+
+	if _, err := cfg.ip_guard.Fail(r.Context(), ipThrottleKey(r)); err != nil {
+		log.Printf("error recording failed login: %s", err)
+	}
+	verdict, err := cfg.account_guard.Fail(r.Context(), accountThrottleKey(email))
+	if err != nil {
+		log.Printf("error recording failed login: %s", err)
+		return
+	}
+	if !verdict.Locked || user == nil {
+		return
+	}
+
+	logSecurityEvent(r, "account_locked", user.ID, "locked for %s after repeated failed logins", verdict.RetryAfter)
+	if err = cfg.sendUnlockEmail(r.Context(), *user); err != nil {
+		log.Printf("error sending unlock email: %s", err)
+	}
+}
+
+// loginSucceeded clears the account's failures once the user is fully
+// logged in.
+func (cfg *apiConfig) loginSucceeded(r *http.Request, user database.User) {
+	cfg.recordLoginAttempt(r, user.Email, user.ID, outcomeSucceeded)
+	if err := cfg.account_guard.Reset(r.Context(), accountThrottleKey(user.Email)); err != nil {
+		log.Printf("error resetting login throttle: %s", err)
+	}
+	if user.DeleteAfter.Valid {
+		cfg.restoreAccount(r, user)
+	}
+}
+
+// recordLoginAttempt writes the attempt to the login audit trail.
+func (cfg *apiConfig) recordLoginAttempt(r *http.Request, email string, userID uuid.UUID, outcome string) {
+	if err := cfg.Db.CreateLoginAttempt(r.Context(), database.CreateLoginAttemptParams{
+		Email:     email,
+		UserID:    uuid.NullUUID{UUID: userID, Valid: userID != uuid.Nil},
+		IpAddress: clientIP(r),
+		UserAgent: r.UserAgent(),
+		Outcome:   outcome,
+	}); err != nil {
+		log.Printf("error recording login attempt: %s", err)
+	}
+	if outcome != outcomeSucceeded && outcome != outcomeSecondFactorRequired {
+		logSecurityEvent(r, "login_"+outcome, userID, "email=%q", email)
+	}
+}
+
+func (cfg *apiConfig) sendUnlockEmail(ctx context.Context, user database.User) error {
+	token, err := cfg.jwt_keys.MakePurposeJWT(user.ID, auth.PurposeUnlock, accountLoginPolicy.LockoutDuration)
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy account has been locked",
+		Body: fmt.Sprintf("There were too many failed attempts to log in to your Chirpy account, so we locked it for an hour.\n\n"+
+			"If that was you, unlock it now with this token:\n%s\n\n"+
+			"If it wasn't, someone may be guessing your password. Consider resetting it.\n", token),
+	})
+}
+
+func (cfg *apiConfig) handleUnlockAccount(w http.ResponseWriter, r *http.Request) {
+	params := struct {
+		Token string `json:"token"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+
+	userid, err := cfg.jwt_keys.ValidatePurposeJWT(params.Token, auth.PurposeUnlock)
+	if err != nil {
+		log.Printf("invalid unlock token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid or expired unlock token")
+		return
+	}
+
+	cfg.unlockAccount(w, r, userid)
+}
+
+// handleAdminUnlockUser lets a moderator unlock someone else's account.
+func (cfg *apiConfig) handleAdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	userid, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("error parsing userID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	cfg.unlockAccount(w, r, userid)
+}
+
+func (cfg *apiConfig) unlockAccount(w http.ResponseWriter, r *http.Request, userid uuid.UUID) {
+	user, err := cfg.Db.GetUserById(r.Context(), userid)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err = cfg.account_guard.Reset(r.Context(), accountThrottleKey(user.Email)); err != nil {
+		log.Printf("error unlocking account: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't unlock account")
+		return
+	}
+
+	logSecurityEvent(r, "account_unlocked", user.ID, "login throttle cleared")
+	w.WriteHeader(http.StatusNoContent)
+}
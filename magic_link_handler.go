@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/database"
+	"github.com/zic20/chirpy/internal/mailer"
+)
+
+const magicLinkLifetime = 15 * time.Minute
+
+// handleRequestMagicLink mails a one-time login token, which the client trades
+// for a session at POST /api/login/magic-link/redeem. Like password resets it
+// answers the same way whether or not the email has an account.
+func (cfg *apiConfig) handleRequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	params := struct {
+		Email string `json:"email"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+	if !cfg.checkMailRequestLimit(w, r, params.Email) {
+		return
+	}
+
+	user, err := cfg.Db.GetUserByEmail(r.Context(), params.Email)
+	if err != nil {
+		log.Printf("magic link requested for unknown email: %s", err)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("error creating magic link token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't send login link")
+		return
+	}
+
+	// Only the latest link works, older ones may be sitting in a mailbox.
+	if err = cfg.Db.DeleteUnusedMagicLinkTokens(r.Context(), user.ID); err != nil {
+		log.Printf("error clearing magic link tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't send login link")
+		return
+	}
+	if err = cfg.Db.CreateMagicLinkToken(r.Context(), database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(magicLinkLifetime),
+	}); err != nil {
+		log.Printf("error storing magic link token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't send login link")
+		return
+	}
+
+	cfg.sendMailInBackground(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy login token",
+		Body: fmt.Sprintf("Enter this login token in Chirpy within the next 15 minutes to log in:\n%s\n\n"+
+			"The token only works once. If you didn't ask for it, you can ignore this email.\n", token),
+	}, "magic link")
+
+	logSecurityEvent(r, "magic_link_requested", user.ID, "login token sent")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleRedeemMagicLink trades a login link for a session. The link stands in
+// for the password only, accounts with two-factor authentication still get a
+// challenge.
+func (cfg *apiConfig) handleRedeemMagicLink(w http.ResponseWriter, r *http.Request) {
+	params := struct {
+		Token            string `json:"token"`
+		ExpiresInSeconds int    `json:"expires_in_seconds"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+
+	userid, err := cfg.Db.UseMagicLinkToken(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		log.Printf("invalid magic link token: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "invalid or expired login link")
+		return
+	}
+
+	user, err := cfg.Db.GetUserById(r.Context(), userid)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "invalid or expired login link")
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		cfg.sendLoginChallenge(w, r, user)
+		return
+	}
+
+	logSecurityEvent(r, "magic_link_login", user.ID, "logged in with a login link")
+	cfg.loginSucceeded(r, user)
+	cfg.completeLogin(w, r, user, params.ExpiresInSeconds)
+}
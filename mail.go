@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"time"
+
+	"github.com/zic20/chirpy/internal/loginguard"
+	"github.com/zic20/chirpy/internal/mailer"
+)
+
+// Endpoints that mail a token to any address they're given share these
+// limits. Every request counts, whether or not the email has an account, so
+// they can't be used to find out who has one. They keep anyone from flooding
+// an inbox, or our mail server.
+var (
+	mailRequestAccountPolicy = loginguard.Policy{
+		FreeAttempts: 3,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}
+	mailRequestIPPolicy = loginguard.Policy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}
+)
+
+// mailTimeout bounds a send that happens after the request was answered.
+const mailTimeout = 30 * time.Second
+
+// loadMailer picks mail delivery from MAIL_DRIVER: "smtp" through the relay
+// at MAIL_SMTP_ADDR, "file" for .eml files in MAIL_DROP_DIR, or "log". Left
+// unset, it goes by which of those is configured and falls back to the log.
+func loadMailer() (mailer.Mailer, error) {
+	from := envOr("MAIL_FROM", "Chirpy <no-reply@chirpy.local>")
+	addr := os.Getenv("MAIL_SMTP_ADDR")
+	dir := os.Getenv("MAIL_DROP_DIR")
+
+	driver := os.Getenv("MAIL_DRIVER")
+	if driver == "" {
+		switch {
+		case addr != "":
+			driver = "smtp"
+		case dir != "":
+			driver = "file"
+		default:
+			log.Print("no mail delivery configured, mail is written to the log, reset and login tokens included")
+			driver = "log"
+		}
+	}
+
+	switch driver {
+	case "smtp":
+		if addr == "" {
+			return nil, errors.New("MAIL_DRIVER=smtp needs MAIL_SMTP_ADDR")
+		}
+		m := &mailer.SMTPMailer{Addr: addr, From: from}
+		if username := os.Getenv("MAIL_SMTP_USERNAME"); username != "" {
+			host, _, _ := net.SplitHostPort(addr)
+			m.Auth = smtp.PlainAuth("", username, os.Getenv("MAIL_SMTP_PASSWORD"), host)
+		}
+		return m, nil
+	case "file":
+		if dir == "" {
+			return nil, errors.New("MAIL_DRIVER=file needs MAIL_DROP_DIR")
+		}
+		return &mailer.FileMailer{Dir: dir, From: from}, nil
+	case "log":
+		return mailer.LogMailer{}, nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_DRIVER %q, expected smtp, file or log", driver)
+}
+
+// checkMailRequestLimit counts the request against the email and the
+// client's IP, and answers with 429 and returns false when either has asked
+// for too much mail. Call it before looking the email up.
+func (cfg *apiConfig) checkMailRequestLimit(w http.ResponseWriter, r *http.Request, email string) bool {
+	checks := []struct {
+		guard *loginguard.Guard
+		key   string
+	}{
+		{cfg.mail_ip_guard, "mail:" + ipThrottleKey(r)},
+		{cfg.mail_account_guard, "mail:" + accountThrottleKey(email)},
+	}
+	for _, check := range checks {
+		verdict, err := check.guard.Check(r.Context(), check.key)
+		if err != nil {
+			log.Printf("error checking mail request limit: %s", err)
+			continue
+		}
+		if !verdict.Allowed() {
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(verdict.RetryAfter.Seconds()))))
+			respondWithError(w, http.StatusTooManyRequests, "too many requests for this email, try again later")
+			return false
+		}
+	}
+	for _, check := range checks {
+		if _, err := check.guard.Fail(r.Context(), check.key); err != nil {
+			log.Printf("error recording mail request: %s", err)
+		}
+	}
+	return true
+}
+
+// sendMailInBackground sends msg without holding up the response. Endpoints
+// that mustn't reveal whether an email has an account use it, since a slow
+// mail server would otherwise show up in the response time.
+func (cfg *apiConfig) sendMailInBackground(msg mailer.Message, what string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+		if err := cfg.mailer.Send(ctx, msg); err != nil {
+			log.Printf("error sending %s email: %s", what, err)
+		}
+	}()
+}
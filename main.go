@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
@@ -8,13 +9,15 @@ import (
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/authn"
 	"github.com/zic20/chirpy/internal/database"
+	"github.com/zic20/chirpy/internal/loginguard"
 )
 
 func main() {
 	godotenv.Load()
 	dbURL := os.Getenv("DB_URL")
-	secret := os.Getenv("TOKEN_SIGNATURE")
 	polka_key := os.Getenv("POLKA_KEY")
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
@@ -24,27 +27,130 @@ func main() {
 
 	dbQueries := database.New(db)
 
+	if err = loadHashParams(); err != nil {
+		log.Fatalf("Error configuring password hashing: %v", err)
+		return
+	}
+
+	deletion_grace, err := loadDeletionGrace()
+	if err != nil {
+		log.Fatalf("Error configuring account deletion: %v", err)
+		return
+	}
+
+	export_dir, export_signer, err := loadExportStore()
+	if err != nil {
+		log.Fatalf("Error configuring data exports: %v", err)
+		return
+	}
+
+	mail, err := loadMailer()
+	if err != nil {
+		log.Fatalf("Error configuring mail: %v", err)
+		return
+	}
+
+	keys, err := loadKeySet()
+	if err != nil {
+		log.Fatalf("Error loading JWT keys: %v", err)
+		return
+	}
+
 	apiCfg := apiConfig{
-		Db:         dbQueries,
-		jwt_secret: secret,
-		polka_key:  polka_key,
+		Db:        dbQueries,
+		jwt_keys:  keys,
+		polka_key: polka_key,
+		mailer:    mail,
+		base_url:  envOr("BASE_URL", "http://localhost:8080"),
+		platform:  os.Getenv("PLATFORM"),
+
+		deletion_grace:     deletion_grace,
+		export_dir:         export_dir,
+		export_signer:      export_signer,
+		export_jobs:        make(chan struct{}, 1),
+		account_guard:      loginguard.New(dbThrottleStore{dbQueries}, accountLoginPolicy),
+		ip_guard:           loginguard.New(dbThrottleStore{dbQueries}, ipLoginPolicy),
+		mail_account_guard: loginguard.New(dbThrottleStore{dbQueries}, mailRequestAccountPolicy),
+		mail_ip_guard:      loginguard.New(dbThrottleStore{dbQueries}, mailRequestIPPolicy),
 	}
 
+	apiCfg.authenticator = authn.New(authn.VerifierFunc(apiCfg.verifyToken), "chirpy")
+
 	mux := http.NewServeMux()
 	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(".")))))
-	mux.HandleFunc("POST /api/chirps", apiCfg.handleCreateChirp)
-	mux.HandleFunc("GET /api/chirps", apiCfg.handleGetAllChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handleGetChirp)
+	mux.Handle("POST /api/chirps", apiCfg.authenticator.Require(scopeChirpsWrite, apiCfg.handleCreateChirp))
+	mux.Handle("GET /api/chirps", apiCfg.authenticator.Optional(scopeChirpsRead, apiCfg.handleGetAllChirps))
+	mux.Handle("GET /api/chirps/{chirpID}", apiCfg.authenticator.Optional(scopeChirpsRead, apiCfg.handleGetChirp))
+	mux.Handle("GET /api/chirps/{chirpID}/replies", apiCfg.authenticator.Optional(scopeChirpsRead, apiCfg.handleGetChirpReplies))
+	mux.Handle("GET /api/chirps/{chirpID}/thread", apiCfg.authenticator.Optional(scopeChirpsRead, apiCfg.handleGetChirpThread))
 	mux.HandleFunc("POST /api/users", apiCfg.handleCreateUser)
-	mux.HandleFunc("PUT /api/users", apiCfg.handleUpdateUser)
+	mux.Handle("PUT /api/users", apiCfg.authenticator.Require(scopeProfileWrite, apiCfg.handleUpdateUser))
+	mux.Handle("DELETE /api/users", apiCfg.authenticator.Require(scopeSession, apiCfg.handleDeleteUser))
+	mux.Handle("POST /api/users/export", apiCfg.authenticator.Require(scopeSession, apiCfg.handleRequestExport))
+	mux.Handle("GET /api/users/export/{exportID}", apiCfg.authenticator.Require(scopeSession, apiCfg.handleGetExport))
+	mux.HandleFunc("GET /api/exports/{exportID}/download", apiCfg.handleDownloadExport)
+	mux.HandleFunc("POST /api/users/verify-email", apiCfg.handleVerifyEmail)
+	mux.Handle("POST /api/users/verify-email/resend", apiCfg.authenticator.Require(scopeSession, apiCfg.handleResendEmailVerification))
+	mux.HandleFunc("GET /api/users/{userID}", apiCfg.handleGetUser)
+	mux.Handle("POST /api/users/{userID}/follow", apiCfg.authenticator.Require(scopeFollowsWrite, apiCfg.handleFollowUser))
+	mux.Handle("DELETE /api/users/{userID}/follow", apiCfg.authenticator.Require(scopeFollowsWrite, apiCfg.handleUnfollowUser))
+	mux.HandleFunc("GET /api/users/{userID}/followers", apiCfg.handleGetFollowers)
+	mux.HandleFunc("GET /api/users/{userID}/following", apiCfg.handleGetFollowing)
+	mux.Handle("GET /api/users/{userID}/likes", apiCfg.authenticator.Optional(scopeChirpsRead, apiCfg.handleGetUserLikes))
+	mux.Handle("GET /api/timeline", apiCfg.authenticator.Require(scopeChirpsRead, apiCfg.handleGetTimeline))
+	mux.Handle("GET /api/mentions", apiCfg.authenticator.Require(scopeChirpsRead, apiCfg.handleGetMentions))
+	mux.Handle("GET /api/search/chirps", apiCfg.authenticator.Optional(scopeChirpsRead, apiCfg.handleSearchChirps))
+	mux.HandleFunc("GET /api/search/users", apiCfg.handleSearchUsers)
+	mux.HandleFunc("GET /api/hashtags/trending", apiCfg.handleGetTrendingHashtags)
+	mux.Handle("GET /api/hashtags/{tag}/chirps", apiCfg.authenticator.Optional(scopeChirpsRead, apiCfg.handleGetHashtagChirps))
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handleIsChirpyRedWebhook)
 	mux.HandleFunc("POST /api/login", apiCfg.handleLogin)
+	mux.HandleFunc("POST /api/login/2fa", apiCfg.handleLoginTOTP)
+	mux.HandleFunc("POST /api/login/unlock", apiCfg.handleUnlockAccount)
+	mux.HandleFunc("POST /api/login/magic-link", apiCfg.handleRequestMagicLink)
+	mux.HandleFunc("POST /api/login/magic-link/redeem", apiCfg.handleRedeemMagicLink)
+	mux.Handle("POST /api/users/2fa/enroll", apiCfg.authenticator.Require(scopeSession, apiCfg.handleEnrollTOTP))
+	mux.Handle("POST /api/users/2fa/confirm", apiCfg.authenticator.Require(scopeSession, apiCfg.handleConfirmTOTP))
+	mux.Handle("DELETE /api/users/2fa", apiCfg.authenticator.Require(scopeSession, apiCfg.handleDisableTOTP))
+	mux.HandleFunc("POST /api/password-reset/request", apiCfg.handleRequestPasswordReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", apiCfg.handleConfirmPasswordReset)
 	mux.HandleFunc("POST /api/refresh", apiCfg.handleRefreshToken)
 	mux.HandleFunc("POST /api/revoke", apiCfg.handleRevokeRefreshToken)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handleDeleteChirp)
-	mux.HandleFunc("POST /admin/reset", apiCfg.resetMetrics)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.getMetrics)
+	mux.Handle("POST /api/tokens", apiCfg.authenticator.Require(scopeSession, apiCfg.handleCreatePersonalAccessToken))
+	mux.Handle("GET /api/tokens", apiCfg.authenticator.Require(scopeSession, apiCfg.handleListPersonalAccessTokens))
+	mux.Handle("GET /api/tokens/{tokenID}", apiCfg.authenticator.Require(scopeSession, apiCfg.handleGetPersonalAccessToken))
+	mux.Handle("PATCH /api/tokens/{tokenID}", apiCfg.authenticator.Require(scopeSession, apiCfg.handleUpdatePersonalAccessToken))
+	mux.Handle("DELETE /api/tokens/{tokenID}", apiCfg.authenticator.Require(scopeSession, apiCfg.handleDeletePersonalAccessToken))
+	mux.Handle("POST /api/oauth/clients", apiCfg.authenticator.Require(scopeSession, apiCfg.handleCreateOAuthClient))
+	mux.Handle("GET /api/oauth/clients", apiCfg.authenticator.Require(scopeSession, apiCfg.handleListOAuthClients))
+	mux.Handle("DELETE /api/oauth/clients/{clientID}", apiCfg.authenticator.Require(scopeSession, apiCfg.handleDeleteOAuthClient))
+	mux.Handle("GET /api/sessions", apiCfg.authenticator.Require(scopeSession, apiCfg.handleListSessions))
+	mux.Handle("DELETE /api/sessions/{sessionID}", apiCfg.authenticator.Require(scopeSession, apiCfg.handleRevokeSession))
+	mux.Handle("POST /api/sessions/revoke-all", apiCfg.authenticator.Require(scopeSession, apiCfg.handleRevokeAllSessions))
+	mux.Handle("DELETE /api/chirps/{chirpID}", apiCfg.authenticator.Require(scopeChirpsWrite, apiCfg.handleDeleteChirp))
+	mux.Handle("PUT /api/chirps/{chirpID}", apiCfg.authenticator.Require(scopeChirpsWrite, apiCfg.handleUpdateChirp))
+	mux.Handle("PATCH /api/chirps/{chirpID}", apiCfg.authenticator.Require(scopeChirpsWrite, apiCfg.handleUpdateChirp))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", apiCfg.handleGetChirpRevisions)
+	mux.Handle("POST /api/chirps/{chirpID}/like", apiCfg.authenticator.Require(scopeChirpsWrite, apiCfg.handleLikeChirp))
+	mux.Handle("DELETE /api/chirps/{chirpID}/like", apiCfg.authenticator.Require(scopeChirpsWrite, apiCfg.handleUnlikeChirp))
+	mux.Handle("POST /api/chirps/{chirpID}/rechirp", apiCfg.authenticator.Require(scopeChirpsWrite, apiCfg.handleRechirp))
+	mux.Handle("DELETE /api/chirps/{chirpID}/rechirp", apiCfg.authenticator.Require(scopeChirpsWrite, apiCfg.handleUndoRechirp))
+	mux.Handle("POST /admin/reset", apiCfg.authenticator.RequireRole(auth.RoleAdmin, apiCfg.resetMetrics))
+	mux.Handle("GET /admin/metrics", apiCfg.authenticator.RequireRole(auth.RoleAdmin, apiCfg.getMetrics))
+	mux.Handle("PUT /admin/users/{userID}/role", apiCfg.authenticator.RequireRole(auth.RoleAdmin, apiCfg.handleSetUserRole))
+	mux.Handle("POST /admin/users/{userID}/unlock", apiCfg.authenticator.RequireRole(auth.RoleModerator, apiCfg.handleAdminUnlockUser))
 	mux.HandleFunc("GET /api/healthz", handleHealth)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.handleGetJWKS)
+	mux.HandleFunc("GET /.well-known/openid-configuration", apiCfg.handleOpenIDConfiguration)
+	mux.HandleFunc("GET /oauth/authorize", apiCfg.handleAuthorize)
+	mux.HandleFunc("POST /oauth/authorize", apiCfg.handleApproveAuthorize)
+	mux.HandleFunc("POST /oauth/token", apiCfg.handleOAuthToken)
+	mux.Handle("GET /oauth/userinfo", apiCfg.authenticator.Require(scopeOpenID, apiCfg.handleUserInfo))
+	mux.Handle("POST /oauth/userinfo", apiCfg.authenticator.Require(scopeOpenID, apiCfg.handleUserInfo))
+	go apiCfg.runAccountPurger(context.Background(), accountPurgeInterval)
+	go apiCfg.runExportWorker(context.Background())
+	go apiCfg.runThrottleSweeper(context.Background(), throttleSweepInterval)
+
 	s := &http.Server{
 		Addr:    ":8080",
 		Handler: middlewareLog(mux),
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/chirptext"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+type Mention struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Username string    `json:"username"`
+}
+
+// indexChirpMentions replaces the mentions stored for chirp with the users
+// mentioned in its current body. Mentions of unknown usernames are dropped.
+func (cfg *apiConfig) indexChirpMentions(ctx context.Context, chirp database.Chirp) error {
+	if err := cfg.Db.DeleteChirpMentions(ctx, chirp.ID); err != nil {
+		return err
+	}
+
+	usernames := chirptext.ExtractMentions(chirp.Body)
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	return cfg.Db.AddChirpMentions(ctx, database.AddChirpMentionsParams{
+		ChirpID:   chirp.ID,
+		Usernames: usernames,
+	})
+}
+
+func (cfg *apiConfig) handleGetMentions(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	page, err := parseFeedParams(r)
+	if err != nil {
+		log.Printf("error parsing pagination params: %v", err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bound := page.bound()
+	chirps, err := cfg.Db.ListMentionChirps(r.Context(), database.ListMentionChirpsParams{
+		UserID:          userid,
+		CursorCreatedAt: bound.CreatedAt,
+		CursorID:        bound.ID,
+		PageSize:        page.fetchSize(),
+	})
+	if err != nil {
+		log.Printf("error fetching mentions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching mentions")
+		return
+	}
+
+	chirps, next, _ := paginate(page, chirps, chirpCursor)
+	setPageLinks(w, r, next, nil)
+
+	response, err := cfg.chirpResponses(r.Context(), chirps, userid)
+	if err != nil {
+		log.Printf("error building chirp responses: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching mentions")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
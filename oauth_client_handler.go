@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+const maxRedirectURIs = 10
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Public       bool      `json:"public"`
+	Secret       string    `json:"client_secret,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func newOAuthClient(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Public:       !client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// validateRedirectURI only allows redirects an authorization code can't leak
+// from: https, http back to the user's own machine, and the reverse-domain
+// schemes native apps register (RFC 8252).
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || strings.Contains(raw, "#") {
+		return fmt.Errorf("redirect uri %q must be an absolute URL without a fragment", raw)
+	}
+
+	switch {
+	case u.Scheme == "https" && u.Host != "":
+	case u.Scheme == "http" && isLoopback(u.Hostname()):
+	case strings.Contains(u.Scheme, "."):
+	default:
+		return fmt.Errorf("redirect uri %q must use https, http on a loopback address, or a reverse-domain app scheme", raw)
+	}
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (cfg *apiConfig) handleCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	params := struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Public       bool     `json:"public"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+
+	name, err := validateTokenName(params.Name)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(params.RedirectURIs) == 0 || len(params.RedirectURIs) > maxRedirectURIs {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("between 1 and %d redirect_uris are required", maxRedirectURIs))
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if err = validateRedirectURI(uri); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// Public clients, such as mobile and single page apps, can't keep a
+	// secret and rely on PKCE alone.
+	secret := ""
+	secret_hash := sql.NullString{}
+	if !params.Public {
+		if secret, err = auth.MakeRefreshToken(); err != nil {
+			log.Printf("error creating client secret: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "couldn't register client")
+			return
+		}
+		secret_hash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.Db.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		OwnerID:      userid,
+		Name:         name,
+		SecretHash:   secret_hash,
+		RedirectUris: params.RedirectURIs,
+	})
+	if err != nil {
+		log.Printf("error storing oauth client: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't register client")
+		return
+	}
+
+	// Only the hash is stored, this is the one time the secret is shown.
+	response := newOAuthClient(client)
+	response.Secret = secret
+	logSecurityEvent(r, "oauth_client_created", userid, "client %s", client.ID)
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) handleListOAuthClients(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	clients, err := cfg.Db.ListOAuthClients(r.Context(), userid)
+	if err != nil {
+		log.Printf("error fetching oauth clients: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching clients")
+		return
+	}
+
+	response := make([]OAuthClient, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, newOAuthClient(client))
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// handleDeleteOAuthClient removes a client along with every refresh token it
+// was issued. Its access tokens run out within the hour.
+func (cfg *apiConfig) handleDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	clientid, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		log.Printf("error parsing clientID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid client id")
+		return
+	}
+
+	deleted, err := cfg.Db.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:      clientid,
+		OwnerID: userid,
+	})
+	if err != nil {
+		log.Printf("error deleting oauth client: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete client")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "client not found")
+		return
+	}
+
+	logSecurityEvent(r, "oauth_client_deleted", userid, "client %s", clientid)
+	w.WriteHeader(http.StatusNoContent)
+}
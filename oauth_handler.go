@@ -0,0 +1,583 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+const (
+	oauthCodeLifetime        = 10 * time.Minute
+	oauthAccessTokenLifetime = time.Hour
+	maxNonceLength           = 255
+)
+
+// Scopes an OAuth client can ask for, in the order the consent screen lists
+// them.
+var oauthScopes = append([]string{scopeOpenID, scopeProfile, scopeEmail}, grantableScopes...)
+
+var scopeDescriptions = map[string]string{
+	scopeOpenID:       "Confirm who you are",
+	scopeProfile:      "See your username, display name and profile",
+	scopeEmail:        "See your email address",
+	scopeChirpsRead:   "Read chirps, including your timeline",
+	scopeChirpsWrite:  "Post, edit and delete chirps as you",
+	scopeFollowsWrite: "Follow and unfollow people as you",
+	scopeProfileWrite: "Update your profile",
+}
+
+// oauthError is an error in the RFC 6749 format, which clients switch on by
+// code.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func respondWithOAuthError(w http.ResponseWriter, code int, err *oauthError) {
+	respondWithJSON(w, code, err)
+}
+
+// authorizeRequest is a checked authorization request. RedirectURI is only
+// set once it is known to belong to the client, before that errors must be
+// shown to the user rather than sent to it.
+type authorizeRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	State         string
+	Scopes        []string
+	CodeChallenge string
+	Nonce         string
+}
+
+func (cfg *apiConfig) parseAuthorizeRequest(ctx context.Context, form url.Values) (authorizeRequest, *oauthError) {
+	req := authorizeRequest{}
+
+	clientid, err := uuid.Parse(form.Get("client_id"))
+	if err != nil {
+		return req, &oauthError{"invalid_request", "unknown client"}
+	}
+	if req.Client, err = cfg.Db.GetOAuthClient(ctx, clientid); err != nil {
+		return req, &oauthError{"invalid_request", "unknown client"}
+	}
+	// Exact matches only, anything looser lets codes be sent elsewhere.
+	if !slices.Contains(req.Client.RedirectUris, form.Get("redirect_uri")) {
+		return req, &oauthError{"invalid_request", "redirect_uri is not registered for this client"}
+	}
+	req.RedirectURI = form.Get("redirect_uri")
+	req.State = form.Get("state")
+
+	if form.Get("response_type") != "code" {
+		return req, &oauthError{"unsupported_response_type", "only the code response type is supported"}
+	}
+	if form.Get("code_challenge_method") != "S256" || !auth.ValidPKCEChallenge(form.Get("code_challenge")) {
+		return req, &oauthError{"invalid_request", "an S256 code_challenge is required"}
+	}
+	req.CodeChallenge = form.Get("code_challenge")
+
+	for _, scope := range strings.Fields(form.Get("scope")) {
+		if !slices.Contains(oauthScopes, scope) {
+			return req, &oauthError{"invalid_scope", "unknown scope " + scope}
+		}
+		if !slices.Contains(req.Scopes, scope) {
+			req.Scopes = append(req.Scopes, scope)
+		}
+	}
+	if len(req.Scopes) == 0 {
+		return req, &oauthError{"invalid_scope", "at least one scope is required"}
+	}
+
+	req.Nonce = form.Get("nonce")
+	if len(req.Nonce) > maxNonceLength {
+		return req, &oauthError{"invalid_request", "nonce is too long"}
+	}
+	return req, nil
+}
+
+// redirect sends the user back to the client with params, plus the state it
+// gave us and our issuer so it can tell which server answered (RFC 9207).
+func (cfg *apiConfig) redirect(w http.ResponseWriter, r *http.Request, req authorizeRequest, params url.Values) {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		// Registered URIs were checked when the client was created.
+		log.Printf("error parsing redirect uri: %s", err)
+		http.Error(w, "invalid redirect uri", http.StatusInternalServerError)
+		return
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", cfg.base_url)
+	u.RawQuery = query.Encode()
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+func (cfg *apiConfig) redirectWithError(w http.ResponseWriter, r *http.Request, req authorizeRequest, oerr *oauthError) {
+	cfg.redirect(w, r, req, url.Values{
+		"error":             {oerr.Code},
+		"error_description": {oerr.Description},
+	})
+}
+
+// handleAuthorize shows the consent screen for an authorization request.
+func (cfg *apiConfig) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	req, oerr := cfg.parseAuthorizeRequest(r.Context(), r.URL.Query())
+	if oerr != nil {
+		if req.RedirectURI == "" {
+			renderConsent(w, http.StatusBadRequest, consentPage{Fatal: oerr.Description})
+			return
+		}
+		cfg.redirectWithError(w, r, req, oerr)
+		return
+	}
+
+	renderConsent(w, http.StatusOK, newConsentPage(req, r.URL.Query()))
+}
+
+// handleApproveAuthorize takes the consent form. The user signs in on the
+// same form, so there's no session cookie for another site to ride on.
+func (cfg *apiConfig) handleApproveAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderConsent(w, http.StatusBadRequest, consentPage{Fatal: "could not parse the form"})
+		return
+	}
+
+	req, oerr := cfg.parseAuthorizeRequest(r.Context(), r.PostForm)
+	if oerr != nil {
+		if req.RedirectURI == "" {
+			renderConsent(w, http.StatusBadRequest, consentPage{Fatal: oerr.Description})
+			return
+		}
+		cfg.redirectWithError(w, r, req, oerr)
+		return
+	}
+
+	if r.PostForm.Get("decision") != "approve" {
+		cfg.redirectWithError(w, r, req, &oauthError{"access_denied", "the user denied the request"})
+		return
+	}
+
+	page := newConsentPage(req, r.PostForm)
+	email := r.PostForm.Get("email")
+	page.Email = email
+
+	if verdict := cfg.loginThrottle(r, email); !verdict.Allowed() {
+		status, msg := throttleResponse(w, verdict)
+		page.Error = msg
+		renderConsent(w, status, page)
+		return
+	}
+
+	user, err := cfg.Db.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		cfg.loginFailed(r, email, nil, outcomeBadCredentials)
+		page.Error = "email or password incorrect"
+		renderConsent(w, http.StatusUnauthorized, page)
+		return
+	}
+	match, err := auth.CheckPasswordHash(r.PostForm.Get("password"), user.HashedPassword)
+	if err != nil {
+		log.Printf("could not verify password: %s", err)
+		page.Error = "something went wrong, please try again"
+		renderConsent(w, http.StatusInternalServerError, page)
+		return
+	}
+	if !match {
+		cfg.loginFailed(r, email, &user, outcomeBadCredentials)
+		page.Error = "email or password incorrect"
+		renderConsent(w, http.StatusUnauthorized, page)
+		return
+	}
+	cfg.rehashPassword(r.Context(), user, r.PostForm.Get("password"))
+
+	if user.TotpEnabledAt.Valid {
+		code := r.PostForm.Get("code")
+		if code == "" {
+			cfg.recordLoginAttempt(r, user.Email, user.ID, outcomeSecondFactorRequired)
+			page.Error = "enter the code from your authenticator app"
+			renderConsent(w, http.StatusUnauthorized, page)
+			return
+		}
+		ok, err := cfg.checkSecondFactor(r.Context(), user, code)
+		if err != nil {
+			log.Printf("error checking second factor: %s", err)
+			page.Error = "something went wrong, please try again"
+			renderConsent(w, http.StatusInternalServerError, page)
+			return
+		}
+		if !ok {
+			cfg.loginFailed(r, user.Email, &user, outcomeBadSecondFactor)
+			page.Error = "invalid two-factor code"
+			renderConsent(w, http.StatusUnauthorized, page)
+			return
+		}
+	}
+	cfg.loginSucceeded(r, user)
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("error creating authorization code: %s", err)
+		cfg.redirectWithError(w, r, req, &oauthError{"server_error", "couldn't create authorization code"})
+		return
+	}
+	if err = cfg.Db.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.Client.ID,
+		UserID:        user.ID,
+		RedirectUri:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		FamilyID:      uuid.New(),
+		AuthTime:      time.Now().UTC(),
+		ExpiresAt:     time.Now().Add(oauthCodeLifetime),
+	}); err != nil {
+		log.Printf("error storing authorization code: %s", err)
+		cfg.redirectWithError(w, r, req, &oauthError{"server_error", "couldn't create authorization code"})
+		return
+	}
+
+	logSecurityEvent(r, "oauth_authorized", user.ID, "client %s granted %v", req.Client.ID, req.Scopes)
+	cfg.redirect(w, r, req, url.Values{"code": {code}})
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+func (cfg *apiConfig) handleOAuthToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if err := r.ParseForm(); err != nil {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_request", "could not parse the form"})
+		return
+	}
+
+	client, oerr := cfg.authenticateOAuthClient(r)
+	if oerr != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		respondWithOAuthError(w, http.StatusUnauthorized, oerr)
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		cfg.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		cfg.refreshOAuthToken(w, r, client)
+	default:
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"unsupported_grant_type", "use authorization_code or refresh_token"})
+	}
+}
+
+// authenticateOAuthClient identifies the client from HTTP basic auth or the
+// form. Confidential clients must prove it with their secret.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, *oauthError) {
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		// RFC 6749 has clients form-encode both before base64.
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	invalid := &oauthError{"invalid_client", "client authentication failed"}
+	clientid, err := uuid.Parse(id)
+	if err != nil {
+		return database.OauthClient{}, invalid
+	}
+	client, err := cfg.Db.GetOAuthClient(r.Context(), clientid)
+	if err != nil {
+		return database.OauthClient{}, invalid
+	}
+	if client.SecretHash.Valid &&
+		subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, invalid
+	}
+	return client, nil
+}
+
+func (cfg *apiConfig) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	invalid := &oauthError{"invalid_grant", "invalid or expired authorization code"}
+	code_hash := auth.HashToken(r.PostForm.Get("code"))
+
+	grant, err := cfg.Db.UseOAuthAuthorizationCode(r.Context(), code_hash)
+	if err != nil {
+		// A code coming back means it leaked, so whatever it was traded for
+		// goes too (RFC 6749 section 4.1.2).
+		if used, err := cfg.Db.GetOAuthAuthorizationCode(r.Context(), code_hash); err == nil && used.UsedAt.Valid {
+			logSecurityEvent(r, "oauth_code_reuse", used.UserID, "revoking tokens issued to client %s", used.ClientID)
+			if err = cfg.Db.RevokeRefreshTokenFamily(r.Context(), used.FamilyID); err != nil {
+				log.Printf("error revoking refresh token family: %s", err)
+			}
+		}
+		respondWithOAuthError(w, http.StatusBadRequest, invalid)
+		return
+	}
+
+	if grant.ClientID != client.ID || grant.RedirectUri != r.PostForm.Get("redirect_uri") {
+		respondWithOAuthError(w, http.StatusBadRequest, invalid)
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), grant.CodeChallenge) {
+		respondWithOAuthError(w, http.StatusBadRequest, &oauthError{"invalid_grant", "code_verifier does not match the code_challenge"})
+		return
+	}
+
+	refresh_token_string, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("error creating refresh token: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "couldn't issue tokens"})
+		return
+	}
+	refresh_token, err := cfg.Db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     refresh_token_string,
+		UserID:    grant.UserID,
+		ExpiresAt: time.Now().Add(refreshTokenLifetime),
+		FamilyID:  grant.FamilyID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:    grant.Scopes,
+	})
+	if err != nil {
+		log.Printf("error storing refresh token: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "couldn't issue tokens"})
+		return
+	}
+
+	response, err := cfg.oauthTokens(client, grant.UserID, grant.Scopes, refresh_token.Token)
+	if err == nil && slices.Contains(grant.Scopes, scopeOpenID) {
+		response.IDToken, err = cfg.jwt_keys.MakeIDToken(cfg.base_url, grant.UserID, client.ID.String(), grant.Nonce, grant.AuthTime, oauthAccessTokenLifetime)
+	}
+	if err != nil {
+		log.Printf("error signing tokens: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "couldn't issue tokens"})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) refreshOAuthToken(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	invalid := &oauthError{"invalid_grant", "invalid or expired refresh token"}
+
+	refresh_token, err := cfg.Db.GetRefreshToken(r.Context(), r.PostForm.Get("refresh_token"))
+	if err != nil || refresh_token.ClientID.UUID != client.ID || !refresh_token.ClientID.Valid {
+		respondWithOAuthError(w, http.StatusBadRequest, invalid)
+		return
+	}
+
+	new_refresh_token, err := cfg.rotateRefreshToken(r, refresh_token)
+	if errors.Is(err, errInvalidRefreshToken) || errors.Is(err, errRefreshTokenExpired) {
+		respondWithOAuthError(w, http.StatusBadRequest, invalid)
+		return
+	}
+	if err != nil {
+		log.Printf("error rotating refresh token: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "couldn't issue tokens"})
+		return
+	}
+
+	response, err := cfg.oauthTokens(client, new_refresh_token.UserID, new_refresh_token.Scopes, new_refresh_token.Token)
+	if err != nil {
+		log.Printf("error signing tokens: %s", err)
+		respondWithOAuthError(w, http.StatusInternalServerError, &oauthError{"server_error", "couldn't issue tokens"})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// oauthTokens issues an access token limited to scopes for client.
+func (cfg *apiConfig) oauthTokens(client database.OauthClient, userID uuid.UUID, scopes []string, refreshToken string) (oauthTokenResponse, error) {
+	token, err := cfg.jwt_keys.MakeScopedJWT(userID, client.ID.String(), scopes, oauthAccessTokenLifetime)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+	return oauthTokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenLifetime.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Name              string `json:"name,omitempty"`
+	Website           string `json:"website,omitempty"`
+	UpdatedAt         int64  `json:"updated_at,omitempty"`
+}
+
+// handleUserInfo is the OIDC userinfo endpoint. What it reveals depends on
+// the email and profile scopes the token holds.
+func (cfg *apiConfig) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	access := principal(r)
+	user, err := cfg.Db.GetUserById(r.Context(), access.UserID)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	info := UserInfo{Subject: user.ID.String()}
+	if access.HasScope(scopeEmail) {
+		verified := user.EmailVerifiedAt.Valid
+		info.Email = user.Email
+		info.EmailVerified = &verified
+	}
+	if access.HasScope(scopeProfile) {
+		info.PreferredUsername = user.Username.String
+		info.Name = user.DisplayName.String
+		info.Website = user.Website.String
+		info.UpdatedAt = user.UpdatedAt.Unix()
+	}
+	respondWithJSON(w, http.StatusOK, info)
+}
+
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	ResponseModesSupported            []string `json:"response_modes_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	IssParameterSupported             bool     `json:"authorization_response_iss_parameter_supported"`
+}
+
+// handleOpenIDConfiguration serves the OIDC discovery document. ID tokens are
+// signed with the same keys as access tokens, so clients can only verify
+// them when JWT_SIGNING_KEY is an asymmetric key.
+func (cfg *apiConfig) handleOpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, OpenIDConfiguration{
+		Issuer:                            cfg.base_url,
+		AuthorizationEndpoint:             cfg.base_url + "/oauth/authorize",
+		TokenEndpoint:                     cfg.base_url + "/oauth/token",
+		UserinfoEndpoint:                  cfg.base_url + "/oauth/userinfo",
+		JWKSURI:                           cfg.base_url + "/.well-known/jwks.json",
+		ScopesSupported:                   oauthScopes,
+		ResponseTypesSupported:            []string{"code"},
+		ResponseModesSupported:            []string{"query"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{cfg.jwt_keys.SigningAlgorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce",
+			"email", "email_verified", "preferred_username", "name", "website", "updated_at"},
+		IssParameterSupported: true,
+	})
+}
+
+type consentScope struct {
+	Name        string
+	Description string
+}
+
+type consentPage struct {
+	// Fatal is set when the request can't go back to the client at all.
+	Fatal      string
+	Error      string
+	ClientName string
+	Scopes     []consentScope
+	Params     map[string]string
+	Email      string
+}
+
+// newConsentPage carries the original request parameters through the form
+// so the POST can check them again.
+func newConsentPage(req authorizeRequest, form url.Values) consentPage {
+	page := consentPage{
+		ClientName: req.Client.Name,
+		Params:     map[string]string{},
+	}
+	for _, scope := range req.Scopes {
+		page.Scopes = append(page.Scopes, consentScope{scope, scopeDescriptions[scope]})
+	}
+	for _, key := range []string{"client_id", "redirect_uri", "response_type", "scope", "state", "code_challenge", "code_challenge_method", "nonce"} {
+		if value := form.Get(key); value != "" {
+			page.Params[key] = value
+		}
+	}
+	return page
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <title>Sign in with Chirpy</title>
+  </head>
+  <body>
+    {{if .Fatal}}
+    <h1>Something's wrong with this request</h1>
+    <p>{{.Fatal}}</p>
+    {{else}}
+    <h1>{{.ClientName}} wants to use your Chirpy account</h1>
+    <p>If you allow it, {{.ClientName}} will be able to:</p>
+    <ul>
+      {{range .Scopes}}<li>{{.Description}} <small>({{.Name}})</small></li>{{end}}
+    </ul>
+    {{if .Error}}<p role="alert"><strong>{{.Error}}</strong></p>{{end}}
+    <form method="post" action="/oauth/authorize">
+      {{range $key, $value := .Params}}<input type="hidden" name="{{$key}}" value="{{$value}}">
+      {{end}}
+      <label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username"></label>
+      <label>Password <input type="password" name="password" autocomplete="current-password"></label>
+      <label>Two-factor code, if enabled <input type="text" name="code" autocomplete="one-time-code"></label>
+      <button type="submit" name="decision" value="approve">Allow</button>
+      <button type="submit" name="decision" value="deny">Deny</button>
+    </form>
+    {{end}}
+  </body>
+</html>
+`))
+
+func renderConsent(w http.ResponseWriter, code int, page consentPage) {
+	// The page takes a password, so no framing it to trick a click.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.WriteHeader(code)
+	if err := consentTemplate.Execute(w, page); err != nil {
+		log.Printf("error rendering consent page: %s", err)
+	}
+}
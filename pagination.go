@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pageCursor marks a position in a feed ordered by (created_at, id). Prev
+// cursors page back towards the start of the feed. Rank is only set for
+// feeds ordered by search relevance first.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+	Rank      float32   `json:"r,omitempty"`
+	Prev      bool      `json:"p,omitempty"`
+}
+
+type pageParams struct {
+	limit  int32
+	desc   bool
+	cursor *pageCursor
+}
+
+var (
+	minCursor = pageCursor{CreatedAt: time.Time{}, ID: uuid.Nil}
+	maxCursor = pageCursor{CreatedAt: time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC), ID: uuid.Max}
+)
+
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// parsePageParams reads the limit, sort and cursor query parameters.
+func parsePageParams(r *http.Request) (pageParams, error) {
+	query := r.URL.Query()
+	p := pageParams{limit: defaultPageSize, desc: query.Get("sort") == "desc"}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return p, errors.New("limit must be a positive integer")
+		}
+		p.limit = int32(min(n, maxPageSize))
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return p, err
+		}
+		p.cursor = &c
+	}
+
+	return p, nil
+}
+
+// parseFeedParams is parsePageParams for newest-first feeds, which can only
+// be paged forwards.
+func parseFeedParams(r *http.Request) (pageParams, error) {
+	p, err := parsePageParams(r)
+	if err != nil {
+		return p, err
+	}
+	if p.cursor != nil && p.cursor.Prev {
+		return p, errors.New("invalid cursor")
+	}
+	p.desc = true
+	return p, nil
+}
+
+// ascending reports whether the page has to be read in ascending order.
+// Walking backwards through a descending feed is an ascending read and
+// vice versa.
+func (p pageParams) ascending() bool {
+	prev := p.cursor != nil && p.cursor.Prev
+	return p.desc == prev
+}
+
+// bound returns the keyset position to read from, falling back to the start
+// of the feed in the read direction.
+func (p pageParams) bound() pageCursor {
+	if p.cursor != nil {
+		return *p.cursor
+	}
+	if p.ascending() {
+		return minCursor
+	}
+	return maxCursor
+}
+
+// fetchSize asks for one extra row so we know if another page follows.
+func (p pageParams) fetchSize() int32 {
+	return p.limit + 1
+}
+
+// paginate trims rows fetched with fetchSize back to the page size, restores
+// the requested order and works out the cursors for the neighbouring pages.
+func paginate[T any](p pageParams, rows []T, key func(T) pageCursor) ([]T, *pageCursor, *pageCursor) {
+	hasMore := len(rows) > int(p.limit)
+	if hasMore {
+		rows = rows[:p.limit]
+	}
+
+	backwards := p.cursor != nil && p.cursor.Prev
+	if backwards {
+		slices.Reverse(rows)
+	}
+
+	if len(rows) == 0 {
+		return rows, nil, nil
+	}
+
+	var next, prev *pageCursor
+	if hasMore || backwards {
+		c := key(rows[len(rows)-1])
+		next = &c
+	}
+	if (backwards && hasMore) || (!backwards && p.cursor != nil) {
+		c := key(rows[0])
+		c.Prev = true
+		prev = &c
+	}
+
+	return rows, next, prev
+}
+
+// setPageLinks advertises the neighbouring pages in a Link header.
+func setPageLinks(w http.ResponseWriter, r *http.Request, next, prev *pageCursor) {
+	links := []string{}
+	for _, page := range []struct {
+		rel    string
+		cursor *pageCursor
+	}{{"next", next}, {"prev", prev}} {
+		if page.cursor == nil {
+			continue
+		}
+		query := r.URL.Query()
+		query.Set("cursor", encodeCursor(*page.cursor))
+		links = append(links, fmt.Sprintf("<%s?%s>; rel=\"%s\"", r.URL.Path, query.Encode(), page.rel))
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+// loadHashParams reads the argon2id cost from ARGON2_MEMORY_KIB,
+// ARGON2_ITERATIONS and ARGON2_PARALLELISM, keeping the library defaults for
+// any that aren't set. Raising them makes existing hashes upgrade as users
+// log in.
+func loadHashParams() error {
+	params := *argon2id.DefaultParams
+	for _, setting := range []struct {
+		env   string
+		bits  int
+		value func(uint64)
+	}{
+		{"ARGON2_MEMORY_KIB", 32, func(v uint64) { params.Memory = uint32(v) }},
+		{"ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }},
+		{"ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }},
+	} {
+		raw := os.Getenv(setting.env)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(raw, 10, setting.bits)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", setting.env, err)
+		}
+		setting.value(v)
+	}
+	return auth.SetHashParams(&params)
+}
+
+// checkPassword answers with the policy violations and returns false when
+// password isn't acceptable.
+func checkPassword(w http.ResponseWriter, password string, personal ...string) bool {
+	err := auth.CheckPasswordPolicy(password, personal...)
+	if err == nil {
+		return true
+	}
+
+	type violation struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	response := struct {
+		Error      string      `json:"error"`
+		Violations []violation `json:"violations"`
+	}{Error: "password does not meet the requirements"}
+
+	var policyErr *auth.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		for _, v := range policyErr.Violations {
+			response.Violations = append(response.Violations, violation{v.Code, v.Message})
+		}
+	}
+	respondWithJSON(w, http.StatusBadRequest, response)
+	return false
+}
+
+// confirmPassword checks the password a signed in user re-entered before a
+// sensitive change, answering and returning false when it's wrong. Guesses
+// count against the login throttle.
+func (cfg *apiConfig) confirmPassword(w http.ResponseWriter, r *http.Request, user database.User, password string) bool {
+	if !cfg.checkLoginThrottle(w, r, user.Email) {
+		return false
+	}
+	match, err := auth.CheckPasswordHash(password, user.HashedPassword)
+	if err != nil {
+		log.Printf("could not verify password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't verify password")
+		return false
+	}
+	if !match {
+		cfg.loginFailed(r, user.Email, &user, outcomeBadCredentials)
+		respondWithError(w, http.StatusUnauthorized, "incorrect password")
+		return false
+	}
+	return true
+}
+
+// rehashPassword upgrades the user's hash if it was made with weaker
+// parameters than the current ones. It's only called once password has been
+// checked, and failures just leave the old hash in place.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, user database.User, password string) {
+	rehash, err := auth.NeedsRehash(user.HashedPassword)
+	if err != nil || !rehash {
+		return
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("error rehashing user password: %s", err)
+		return
+	}
+	if _, err = cfg.Db.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHash: hash,
+		ID:      user.ID,
+		OldHash: user.HashedPassword,
+	}); err != nil {
+		log.Printf("error storing rehashed password: %s", err)
+	}
+}
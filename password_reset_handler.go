@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/database"
+	"github.com/zic20/chirpy/internal/mailer"
+)
+
+const passwordResetLifetime = time.Hour
+
+// handleRequestPasswordReset mails a reset token, which the client sends back
+// with the new password to POST /api/password-reset/confirm. It answers the
+// same way whether or not the email belongs to an account so it can't be used
+// to find out who has one.
+func (cfg *apiConfig) handleRequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	params := struct {
+		Email string `json:"email"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+	if !cfg.checkMailRequestLimit(w, r, params.Email) {
+		return
+	}
+
+	user, err := cfg.Db.GetUserByEmail(r.Context(), params.Email)
+	if err != nil {
+		log.Printf("password reset requested for unknown email: %s", err)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("error creating password reset token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't request password reset")
+		return
+	}
+
+	// Only the latest link works, older ones may be sitting in a mailbox.
+	if err = cfg.Db.DeleteUnusedPasswordResetTokens(r.Context(), user.ID); err != nil {
+		log.Printf("error clearing password reset tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't request password reset")
+		return
+	}
+	if err = cfg.Db.CreatePasswordResetToken(r.Context(), database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(passwordResetLifetime),
+	}); err != nil {
+		log.Printf("error storing password reset token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't request password reset")
+		return
+	}
+
+	cfg.sendMailInBackground(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"Enter this reset token in Chirpy within the next hour to choose a new one:\n%s\n\n"+
+			"If it wasn't you, ignore this email and your password stays the same.\n", token),
+	}, "password reset")
+
+	logSecurityEvent(r, "password_reset_requested", user.ID, "reset token sent")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) handleConfirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	params := struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+
+	// Look the user up without using the token, so a password the policy
+	// refuses doesn't cost them the link.
+	userid, err := cfg.Db.GetPasswordResetTokenUser(r.Context(), auth.HashToken(params.Token))
+	if err != nil {
+		log.Printf("invalid password reset token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid or expired reset token")
+		return
+	}
+	user, err := cfg.Db.GetUserById(r.Context(), userid)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid or expired reset token")
+		return
+	}
+
+	if !checkPassword(w, params.Password, user.Email, user.Username.String) {
+		return
+	}
+
+	hash, err := auth.HashPassword(params.Password)
+	if err != nil {
+		log.Printf("error hashing user password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't reset password")
+		return
+	}
+
+	// Using the token is what guards against two resets racing.
+	if _, err = cfg.Db.UsePasswordResetToken(r.Context(), auth.HashToken(params.Token)); err != nil {
+		log.Printf("invalid password reset token: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid or expired reset token")
+		return
+	}
+
+	if err = cfg.Db.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: hash,
+		ID:             user.ID,
+	}); err != nil {
+		log.Printf("error updating password: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't reset password")
+		return
+	}
+
+	// Whoever knew the old password shouldn't keep a session.
+	if err = cfg.revokeAllSessions(r.Context(), user.ID); err != nil {
+		log.Printf("error revoking sessions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't reset password")
+		return
+	}
+
+	// Getting the reset email proves ownership, so it unlocks the account
+	// as well.
+	if err = cfg.account_guard.Reset(r.Context(), accountThrottleKey(user.Email)); err != nil {
+		log.Printf("error resetting login throttle: %s", err)
+	}
+
+	logSecurityEvent(r, "password_reset", user.ID, "password reset, sessions revoked")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+const (
+	maxTokenNameLength   = 100
+	maxTokenLifetimeDays = 366
+)
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Hint       string     `json:"token_hint"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func newPersonalAccessToken(pat database.PersonalAccessToken) PersonalAccessToken {
+	response := PersonalAccessToken{
+		ID:        pat.ID,
+		Name:      pat.Name,
+		Scopes:    pat.Scopes,
+		Hint:      pat.TokenPrefix,
+		CreatedAt: pat.CreatedAt,
+	}
+	if pat.ExpiresAt.Valid {
+		response.ExpiresAt = &pat.ExpiresAt.Time
+	}
+	if pat.LastUsedAt.Valid {
+		response.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	return response
+}
+
+type personalAccessTokenParams struct {
+	Name          *string  `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// validateTokenName trims name and checks it fits.
+func validateTokenName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if len([]rune(name)) > maxTokenNameLength {
+		return "", fmt.Errorf("name must be at most %d characters", maxTokenNameLength)
+	}
+	return name, nil
+}
+
+// validateScopes checks every scope can be granted and drops duplicates.
+func validateScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	valid := []string{}
+	for _, scope := range scopes {
+		if !slices.Contains(grantableScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(grantableScopes, ", "))
+		}
+		if !slices.Contains(valid, scope) {
+			valid = append(valid, scope)
+		}
+	}
+	return valid, nil
+}
+
+func (cfg *apiConfig) handleCreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	params := personalAccessTokenParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+
+	if params.Name == nil {
+		respondWithError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	name, err := validateTokenName(*params.Name)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	scopes, err := validateScopes(params.Scopes)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if params.ExpiresInDays < 0 || params.ExpiresInDays > maxTokenLifetimeDays {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("expires_in_days must be between 0 and %d", maxTokenLifetimeDays))
+		return
+	}
+	expires_at := sql.NullTime{}
+	if params.ExpiresInDays > 0 {
+		expires_at = sql.NullTime{Time: time.Now().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		log.Printf("error creating personal access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't create token")
+		return
+	}
+
+	pat, err := cfg.Db.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:      userid,
+		Name:        name,
+		TokenHash:   auth.HashToken(token),
+		TokenPrefix: auth.PersonalAccessTokenHint(token),
+		Scopes:      scopes,
+		ExpiresAt:   expires_at,
+	})
+	if err != nil {
+		log.Printf("error storing personal access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't create token")
+		return
+	}
+
+	// Only the hash is stored, this is the one time the token is shown.
+	response := newPersonalAccessToken(pat)
+	response.Token = token
+	logSecurityEvent(r, "pat_created", userid, "token %s with scopes %v", pat.ID, pat.Scopes)
+	respondWithJSON(w, http.StatusCreated, response)
+}
+
+func (cfg *apiConfig) handleListPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	pats, err := cfg.Db.ListPersonalAccessTokens(r.Context(), userid)
+	if err != nil {
+		log.Printf("error fetching personal access tokens: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching tokens")
+		return
+	}
+
+	response := make([]PersonalAccessToken, 0, len(pats))
+	for _, pat := range pats {
+		response = append(response, newPersonalAccessToken(pat))
+	}
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handleGetPersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	tokenid, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		log.Printf("error parsing tokenID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid token id")
+		return
+	}
+
+	pat, err := cfg.Db.GetPersonalAccessToken(r.Context(), database.GetPersonalAccessTokenParams{
+		ID:     tokenid,
+		UserID: userid,
+	})
+	if err != nil {
+		log.Printf("personal access token not found: %s", err)
+		respondWithError(w, http.StatusNotFound, "token not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newPersonalAccessToken(pat))
+}
+
+func (cfg *apiConfig) handleUpdatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	tokenid, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		log.Printf("error parsing tokenID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid token id")
+		return
+	}
+
+	params := personalAccessTokenParams{}
+	if err = json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+
+	pat, err := cfg.Db.GetPersonalAccessToken(r.Context(), database.GetPersonalAccessTokenParams{
+		ID:     tokenid,
+		UserID: userid,
+	})
+	if err != nil {
+		log.Printf("personal access token not found: %s", err)
+		respondWithError(w, http.StatusNotFound, "token not found")
+		return
+	}
+
+	name := pat.Name
+	if params.Name != nil {
+		if name, err = validateTokenName(*params.Name); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	scopes := pat.Scopes
+	if params.Scopes != nil {
+		if scopes, err = validateScopes(params.Scopes); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	pat, err = cfg.Db.UpdatePersonalAccessToken(r.Context(), database.UpdatePersonalAccessTokenParams{
+		Name:   name,
+		Scopes: scopes,
+		ID:     tokenid,
+		UserID: userid,
+	})
+	if err != nil {
+		log.Printf("error updating personal access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't update token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newPersonalAccessToken(pat))
+}
+
+func (cfg *apiConfig) handleDeletePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	tokenid, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		log.Printf("error parsing tokenID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid token id")
+		return
+	}
+
+	deleted, err := cfg.Db.DeletePersonalAccessToken(r.Context(), database.DeletePersonalAccessTokenParams{
+		ID:     tokenid,
+		UserID: userid,
+	})
+	if err != nil {
+		log.Printf("error deleting personal access token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete token")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "token not found")
+		return
+	}
+
+	logSecurityEvent(r, "pat_deleted", userid, "token %s", tokenid)
+	w.WriteHeader(http.StatusNoContent)
+}
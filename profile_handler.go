@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxLocationLength    = 30
+	maxWebsiteLength     = 100
+	maxUserSearchResults = 20
+)
+
+// PublicProfile is what anyone can see about a user. It must never carry
+// the email or password hash.
+type PublicProfile struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Username    string    `json:"username,omitempty"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Bio         string    `json:"bio,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Website     string    `json:"website,omitempty"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+func newPublicProfile(user database.User) PublicProfile {
+	return PublicProfile{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		Username:    user.Username.String,
+		DisplayName: user.DisplayName.String,
+		Bio:         user.Bio.String,
+		Location:    user.Location.String,
+		Website:     user.Website.String,
+		IsChirpyRed: user.IsChirpyRed,
+	}
+}
+
+// profileField applies an optional update to a profile column. A nil update
+// keeps the current value and an empty string clears it.
+func profileField(current sql.NullString, update *string, name string, maxLength int) (sql.NullString, error) {
+	if update == nil {
+		return current, nil
+	}
+	value := strings.TrimSpace(*update)
+	if value == "" {
+		return sql.NullString{}, nil
+	}
+	if utf8.RuneCountInString(value) > maxLength {
+		return current, fmt.Errorf("%s must be at most %d characters", name, maxLength)
+	}
+	return sql.NullString{String: value, Valid: true}, nil
+}
+
+func validateWebsite(website sql.NullString) error {
+	if !website.Valid {
+		return nil
+	}
+	u, err := url.Parse(website.String)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("website must be an http or https URL")
+	}
+	return nil
+}
+
+func (cfg *apiConfig) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	userid, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("error parsing userID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	// Accounts waiting out their deletion grace period look deleted.
+	user, err := cfg.Db.GetUserById(r.Context(), userid)
+	if err != nil || user.DeleteAfter.Valid {
+		log.Printf("user not found: %v", err)
+		respondWithError(w, http.StatusNotFound, "user does not exist")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newPublicProfile(user))
+}
+
+func (cfg *apiConfig) handleSearchUsers(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	q = strings.TrimPrefix(q, "@")
+	if q == "" {
+		respondWithError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	// Escape LIKE wildcards so they match literally; underscores are common
+	// in usernames.
+	prefix := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q)
+
+	users, err := cfg.Db.SearchUsers(r.Context(), database.SearchUsersParams{
+		Prefix:     prefix,
+		MaxResults: maxUserSearchResults,
+	})
+	if err != nil {
+		log.Printf("error searching users: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error searching users")
+		return
+	}
+
+	response := []PublicProfile{}
+	for _, user := range users {
+		response = append(response, newPublicProfile(user))
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+// originalChirp looks up a live chirp, following plain rechirps back to the
+// chirp they repost so rechirps and quotes always reference the original.
+func (cfg *apiConfig) originalChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, err := cfg.Db.GetChirp(ctx, id)
+	if err != nil {
+		return chirp, err
+	}
+	if chirp.RechirpOf.Valid {
+		chirp, err = cfg.Db.GetChirp(ctx, chirp.RechirpOf.UUID)
+		if err != nil {
+			return chirp, err
+		}
+	}
+	if chirp.DeletedAt.Valid {
+		return chirp, errors.New("chirp has been deleted")
+	}
+	return chirp, nil
+}
+
+func (cfg *apiConfig) handleRechirp(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("error parsing chirpID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id")
+		return
+	}
+
+	original, err := cfg.originalChirp(r.Context(), chirpid)
+	if err != nil {
+		log.Printf("chirp not found: %s", err)
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+
+	status := http.StatusCreated
+	rechirp, err := cfg.Db.CreateRechirp(r.Context(), database.CreateRechirpParams{
+		UserID:    userid,
+		RechirpOf: original.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// Already rechirped, hand back the existing one.
+		status = http.StatusOK
+		rechirp, err = cfg.Db.GetRechirp(r.Context(), database.GetRechirpParams{
+			UserID:    userid,
+			RechirpOf: original.ID,
+		})
+	}
+	if err != nil {
+		log.Printf("error creating rechirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't rechirp")
+		return
+	}
+
+	response, err := cfg.chirpResponse(r.Context(), rechirp, userid)
+	if err != nil {
+		log.Printf("error building chirp response: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't rechirp")
+		return
+	}
+	respondWithJSON(w, status, response)
+}
+
+func (cfg *apiConfig) handleUndoRechirp(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("error parsing chirpID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id")
+		return
+	}
+
+	if err = cfg.Db.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:    userid,
+		RechirpOf: chirpid,
+	}); err != nil {
+		log.Printf("error undoing rechirp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't undo rechirp")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+// handleSetUserRole changes a user's role. The user is signed out everywhere
+// so no access token keeps the old role around until it expires.
+func (cfg *apiConfig) handleSetUserRole(w http.ResponseWriter, r *http.Request) {
+	userid, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		log.Printf("error parsing userID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid user id")
+		return
+	}
+
+	params := struct {
+		Role string `json:"role"`
+	}{}
+	if err = json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+	if !auth.ValidRole(params.Role) {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("role must be one of %s, %s or %s", auth.RoleUser, auth.RoleModerator, auth.RoleAdmin))
+		return
+	}
+
+	admin := principal(r)
+	// An admin demoting themselves could leave nobody able to undo it.
+	if admin.UserID == userid {
+		respondWithError(w, http.StatusBadRequest, "admins can't change their own role")
+		return
+	}
+
+	user, err := cfg.Db.SetUserRole(r.Context(), database.SetUserRoleParams{
+		Role: params.Role,
+		ID:   userid,
+	})
+	if err != nil {
+		log.Printf("error setting user role: %s", err)
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	if err = cfg.revokeAllSessions(r.Context(), user.ID); err != nil {
+		log.Printf("error revoking sessions: %s", err)
+	}
+
+	logSecurityEvent(r, "role_changed", user.ID, "role set to %s by %s", user.Role, admin.UserID)
+	respondWithJSON(w, http.StatusOK, newUser(user))
+}
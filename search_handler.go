@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+const (
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+)
+
+func (cfg *apiConfig) handleSearchChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		respondWithError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	page, err := parseFeedParams(r)
+	if err != nil {
+		log.Printf("error parsing pagination params: %v", err)
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	params := database.SearchChirpsParams{
+		Query:    q,
+		PageSize: page.fetchSize(),
+	}
+
+	if author_id := query.Get("author_id"); author_id != "" {
+		user_id, err := uuid.Parse(author_id)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "author_id could not be parsed")
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: user_id, Valid: true}
+	}
+
+	for _, filter := range []struct {
+		name  string
+		value *sql.NullTime
+	}{{"since", &params.CreatedAfter}, {"until", &params.CreatedBefore}} {
+		param := query.Get(filter.name)
+		if param == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, filter.name+" must be an RFC 3339 timestamp")
+			return
+		}
+		*filter.value = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+
+	bound := page.bound()
+	params.CursorRank = bound.Rank
+	params.CursorCreatedAt = bound.CreatedAt
+	params.CursorID = bound.ID
+	if page.cursor == nil {
+		params.CursorRank = math.MaxFloat32
+	}
+
+	results, err := cfg.Db.SearchChirps(r.Context(), params)
+	if err != nil {
+		log.Printf("error searching chirps: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error searching chirps")
+		return
+	}
+
+	results, next, _ := paginate(page, results, func(result database.SearchChirpsRow) pageCursor {
+		return pageCursor{CreatedAt: result.Chirp.CreatedAt, ID: result.Chirp.ID, Rank: result.Rank}
+	})
+	setPageLinks(w, r, next, nil)
+
+	chirps := make([]database.Chirp, 0, len(results))
+	for _, result := range results {
+		chirps = append(chirps, result.Chirp)
+	}
+
+	response, err := cfg.chirpResponses(r.Context(), chirps, cfg.viewerID(r))
+	if err != nil {
+		log.Printf("error building chirp responses: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error searching chirps")
+		return
+	}
+	for i := range response {
+		response[i].Snippet = escapeSnippet(results[i].Snippet)
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// escapeSnippet HTML-escapes a ts_headline snippet while keeping the
+// highlight markers, so clients can render it without trusting chirp bodies.
+func escapeSnippet(snippet string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(snippet, highlightStart) {
+		if i > 0 {
+			b.WriteString(highlightStart)
+		}
+		marked, rest, found := strings.Cut(part, highlightStop)
+		b.WriteString(html.EscapeString(marked))
+		if found {
+			b.WriteString(highlightStop)
+			b.WriteString(html.EscapeString(rest))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/authn"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+// logSecurityEvent records events worth a closer look, such as stolen
+// credentials being replayed, with a greppable prefix.
+func logSecurityEvent(r *http.Request, event string, userID uuid.UUID, format string, args ...any) {
+	log.Printf("SECURITY %s user=%s remote=%s: %s", event, userID, r.RemoteAddr, fmt.Sprintf(format, args...))
+}
+
+// Scopes a personal access token or OAuth client can be granted. Password
+// sessions hold every scope.
+const (
+	scopeChirpsRead   = "chirps:read"
+	scopeChirpsWrite  = "chirps:write"
+	scopeFollowsWrite = "follows:write"
+	scopeProfileWrite = "profile:write"
+
+	// OpenID Connect scopes, which only OAuth clients ask for.
+	scopeOpenID  = "openid"
+	scopeProfile = "profile"
+	scopeEmail   = "email"
+
+	// scopeSession marks routes that manage the account itself, such as
+	// sessions, 2FA and the tokens themselves. No token can be granted it.
+	scopeSession = ""
+)
+
+var grantableScopes = []string{scopeChirpsRead, scopeChirpsWrite, scopeFollowsWrite, scopeProfileWrite}
+
+// verifyToken accepts a JWT from a password login, or an OAuth access token
+// or personal access token, and returns who is behind it. It's the Verifier
+// behind cfg.authenticator.
+func (cfg *apiConfig) verifyToken(ctx context.Context, token string) (authn.Principal, error) {
+	if !auth.IsPersonalAccessToken(token) {
+		access, err := cfg.validateAccessToken(ctx, token)
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return authn.Principal{}, authn.InvalidToken("token has expired")
+		}
+		if err != nil {
+			return authn.Principal{}, err
+		}
+
+		principal := authn.Principal{
+			UserID:   access.UserID,
+			Role:     access.Role,
+			Kind:     authn.KindSession,
+			ClientID: access.ClientID,
+			TokenID:  access.ID,
+		}
+		if access.ClientID != "" {
+			principal.Kind = authn.KindOAuth
+			principal.Scopes = access.Scopes
+		}
+		return principal, nil
+	}
+
+	pat, err := cfg.Db.GetPersonalAccessTokenByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		return authn.Principal{}, authn.InvalidToken("invalid token")
+	}
+	if pat.ExpiresAt.Valid && !pat.ExpiresAt.Time.After(time.Now()) {
+		return authn.Principal{}, authn.InvalidToken("token has expired")
+	}
+
+	if err = cfg.Db.TouchPersonalAccessToken(ctx, pat.ID); err != nil {
+		log.Printf("error updating token last used: %s", err)
+	}
+	return authn.Principal{
+		UserID:  pat.UserID,
+		Role:    auth.RoleUser,
+		Kind:    authn.KindPersonalAccessToken,
+		Scopes:  pat.Scopes,
+		TokenID: pat.ID.String(),
+	}, nil
+}
+
+// principal returns who the authenticator let the request through as.
+func principal(r *http.Request) authn.Principal {
+	p, _ := authn.FromContext(r.Context())
+	return p
+}
+
+// validateAccessToken validates an access token and rejects it if the user
+// revoked all their sessions after it was issued, or their account is
+// scheduled for deletion.
+func (cfg *apiConfig) validateAccessToken(ctx context.Context, token string) (auth.AccessToken, error) {
+	access, err := cfg.jwt_keys.ValidateAccessJWT(token)
+	if err != nil {
+		return auth.AccessToken{}, err
+	}
+
+	state, err := cfg.Db.GetUserTokenState(ctx, access.UserID)
+	if err != nil {
+		return auth.AccessToken{}, err
+	}
+	if state.TokensValidAfter.Valid && access.IssuedAt.Before(state.TokensValidAfter.Time) {
+		return auth.AccessToken{}, authn.InvalidToken("token has been revoked")
+	}
+	if state.DeleteAfter.Valid {
+		return auth.AccessToken{}, authn.InvalidToken("account is scheduled for deletion")
+	}
+
+	return access, nil
+}
+
+// revokeAllSessions signs a user out everywhere. Refresh tokens are revoked
+// outright, and access tokens issued before now stop validating. Personal
+// access tokens go too, otherwise a stolen session could mint one that
+// outlives signing out or resetting the password.
+func (cfg *apiConfig) revokeAllSessions(ctx context.Context, userID uuid.UUID) error {
+	if err := cfg.Db.RevokeAllUserRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+	if err := cfg.Db.DeleteAllPersonalAccessTokens(ctx, userID); err != nil {
+		return err
+	}
+	// JWT iat only has second precision, so truncate to match it.
+	return cfg.Db.RevokeUserAccessTokens(ctx, database.RevokeUserAccessTokensParams{
+		ValidAfter: time.Now().UTC().Truncate(time.Second),
+		ID:         userID,
+	})
+}
+
+// clientIP returns the address of the peer that sent the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IpAddress  string    `json:"ip_address"`
+	StartedAt  time.Time `json:"started_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Client     string    `json:"client,omitempty"`
+}
+
+func (cfg *apiConfig) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	rows, err := cfg.Db.ListActiveSessions(r.Context(), userid)
+	if err != nil {
+		log.Printf("error fetching sessions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching sessions")
+		return
+	}
+
+	sessions := make([]Session, 0, len(rows))
+	for _, row := range rows {
+		sessions = append(sessions, Session{
+			ID:         row.FamilyID,
+			UserAgent:  row.UserAgent,
+			IpAddress:  row.IpAddress,
+			StartedAt:  row.StartedAt,
+			LastUsedAt: row.LastUsedAt,
+			ExpiresAt:  row.ExpiresAt,
+			Client:     row.ClientName.String,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+func (cfg *apiConfig) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	sessionid, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		log.Printf("error parsing sessionID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid session id")
+		return
+	}
+
+	revoked, err := cfg.Db.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionid,
+		UserID:   userid,
+	})
+	if err != nil {
+		log.Printf("error revoking session: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't revoke session")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "session not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	if err := cfg.revokeAllSessions(r.Context(), userid); err != nil {
+		log.Printf("error revoking sessions: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't revoke sessions")
+		return
+	}
+
+	logSecurityEvent(r, "sessions_revoked", userid, "all sessions revoked by user")
+	w.WriteHeader(http.StatusNoContent)
+}
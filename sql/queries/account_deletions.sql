@@ -0,0 +1,16 @@
+-- name: PurgeUser :execrows
+-- Deletes a user whose grace period is over and records the anonymized
+-- audit entry in the same statement. Everything the user owns cascades.
+WITH deleted AS (
+    DELETE FROM users
+    WHERE id = sqlc.arg(id) AND delete_after <= NOW()
+    RETURNING created_at, deletion_requested_at
+)
+INSERT INTO account_deletions (id, account_created_on, requested_at, deleted_at, chirp_count)
+SELECT
+    gen_random_uuid(),
+    created_at::date,
+    deletion_requested_at,
+    NOW(),
+    (SELECT COUNT(*) FROM chirps WHERE user_id = sqlc.arg(id))
+FROM deleted;
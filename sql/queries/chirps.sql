@@ -1,19 +1,48 @@
 -- name: CreateChirp :one 
-INSERT INTO chirps (id,created_at,updated_at,body,user_id)
+INSERT INTO chirps (id,created_at,updated_at,body,user_id,in_reply_to,quote_of)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 ) RETURNING *;
 
+-- name: CreateRechirp :one
+INSERT INTO chirps (id,created_at,updated_at,body,user_id,rechirp_of)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    '',
+    sqlc.arg(user_id),
+    sqlc.arg(rechirp_of)::uuid
+)
+ON CONFLICT (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL DO NOTHING
+RETURNING *;
+
+-- name: GetRechirp :one
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id) AND rechirp_of = sqlc.arg(rechirp_of)::uuid;
+
+-- name: DeleteRechirp :exec
+DELETE FROM chirps
+WHERE user_id = sqlc.arg(user_id) AND rechirp_of = sqlc.arg(rechirp_of)::uuid;
+
+-- name: GetRechirpCounts :many
+SELECT rechirp_of, COUNT(*) AS rechirp_count FROM chirps
+WHERE rechirp_of = ANY(sqlc.arg(chirp_ids)::uuid[])
+GROUP BY rechirp_of;
+
 -- name: GetAllChirps :many
-SELECT * FROM chirps;
+SELECT * FROM chirps
+WHERE deleted_at IS NULL;
 
 -- name: GetChirpsForUser :many
 SELECT * FROM chirps
-WHERE user_id = $1;
+WHERE user_id = $1 AND deleted_at IS NULL;
 
 -- name: GetChirp :one
 SELECT * FROM chirps
@@ -21,4 +50,99 @@ WHERE id = $1;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps
-WHERE id= $1;
\ No newline at end of file
+WHERE id= $1;
+
+-- name: TombstoneChirp :exec
+-- Blanks the chirp and drops everything that came from its text in one
+-- statement, so a failure can't leave a tombstone with rechirps, hashtags or
+-- mentions still attached.
+WITH revisions AS (
+    DELETE FROM chirp_revisions WHERE chirp_id = $1
+), rechirps AS (
+    DELETE FROM chirps WHERE rechirp_of = $1
+), tags AS (
+    DELETE FROM chirp_hashtags WHERE chirp_id = $1
+), mentioned AS (
+    DELETE FROM mentions WHERE chirp_id = $1
+)
+UPDATE chirps
+SET body = '', deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: ChirpHasDependents :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps
+    WHERE in_reply_to = sqlc.arg(id)::uuid OR quote_of = sqlc.arg(id)::uuid
+);
+
+-- name: ListChirpsAfter :many
+-- Feeds leave out chirps by accounts waiting to be deleted.
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE (chirps.created_at, chirps.id) > (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::uuid)
+AND (sqlc.narg(author_id)::uuid IS NULL OR chirps.user_id = sqlc.narg(author_id))
+AND chirps.deleted_at IS NULL
+AND users.delete_after IS NULL
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListChirpsBefore :many
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE (chirps.created_at, chirps.id) < (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::uuid)
+AND (sqlc.narg(author_id)::uuid IS NULL OR chirps.user_id = sqlc.narg(author_id))
+AND chirps.deleted_at IS NULL
+AND users.delete_after IS NULL
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListTimelineChirps :many
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+JOIN users ON users.id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg(user_id)
+AND (chirps.created_at, chirps.id) < (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::uuid)
+AND chirps.deleted_at IS NULL
+AND users.delete_after IS NULL
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListReplies :many
+SELECT * FROM chirps
+WHERE in_reply_to = sqlc.arg(id)::uuid
+ORDER BY created_at ASC, id ASC;
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.in_reply_to FROM chirps parent
+    WHERE parent.id = (SELECT child.in_reply_to FROM chirps child WHERE child.id = sqlc.arg(id)::uuid)
+    UNION ALL
+    SELECT chirps.id, chirps.in_reply_to FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.in_reply_to
+)
+SELECT * FROM chirps
+WHERE id IN (SELECT id FROM ancestors)
+ORDER BY created_at ASC, id ASC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT chirps.id FROM chirps
+    WHERE chirps.in_reply_to = sqlc.arg(id)::uuid
+    UNION ALL
+    SELECT chirps.id FROM chirps
+    JOIN descendants ON chirps.in_reply_to = descendants.id
+)
+SELECT * FROM chirps
+WHERE id IN (SELECT id FROM descendants)
+ORDER BY created_at ASC, id ASC;
+
+-- name: EditChirp :one
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at)
+    SELECT gen_random_uuid(), chirps.id, chirps.body, NOW() FROM chirps
+    WHERE chirps.id = sqlc.arg(id)
+)
+UPDATE chirps
+SET body = sqlc.arg(body), edited_at = NOW(), updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
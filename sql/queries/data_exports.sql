@@ -0,0 +1,62 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, user_id, status, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    'pending',
+    NOW()
+)
+RETURNING *;
+
+-- name: GetActiveDataExport :one
+SELECT * FROM data_exports
+WHERE user_id = $1 AND status IN ('pending', 'running')
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: GetDataExport :one
+SELECT * FROM data_exports
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetDataExportByID :one
+SELECT * FROM data_exports
+WHERE id = $1;
+
+-- name: ListUserDataExports :many
+SELECT * FROM data_exports
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: ClaimDataExport :one
+-- Takes the oldest pending export, skipping any another worker is claiming.
+UPDATE data_exports
+SET status = 'running', started_at = NOW()
+WHERE id = (
+    SELECT id FROM data_exports
+    WHERE status = 'pending'
+    ORDER BY created_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET status = 'ready', completed_at = NOW(), expires_at = sqlc.arg(expires_at)::timestamp
+WHERE id = sqlc.arg(id);
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET status = 'failed', completed_at = NOW(), expires_at = sqlc.arg(expires_at)::timestamp
+WHERE id = sqlc.arg(id);
+
+-- name: RequeueStaleDataExports :exec
+-- Puts back exports whose worker died mid-way.
+UPDATE data_exports
+SET status = 'pending', started_at = NULL
+WHERE status = 'running' AND started_at < sqlc.arg(started_before)::timestamp;
+
+-- name: DeleteExpiredDataExports :many
+DELETE FROM data_exports
+WHERE expires_at <= NOW()
+RETURNING id;
@@ -0,0 +1,36 @@
+-- name: AddChirpHashtags :exec
+-- Rows take the chirp's created_at, so re-indexing an edited chirp doesn't
+-- make its tags trend again.
+WITH tags AS (
+    INSERT INTO hashtags (id, tag, created_at)
+    SELECT gen_random_uuid(), new_tag, NOW() FROM unnest(sqlc.arg(tags)::text[]) AS new_tag
+    ON CONFLICT (tag) DO UPDATE SET tag = EXCLUDED.tag
+    RETURNING id
+)
+INSERT INTO chirp_hashtags (chirp_id, hashtag_id, created_at)
+SELECT sqlc.arg(chirp_id)::uuid, tags.id, sqlc.arg(created_at)::timestamp FROM tags
+ON CONFLICT (chirp_id, hashtag_id) DO NOTHING;
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
+
+-- name: ListHashtagChirps :many
+SELECT chirps.* FROM chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+JOIN users ON users.id = chirps.user_id
+WHERE hashtags.tag = sqlc.arg(tag)
+AND (chirps.created_at, chirps.id) < (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::uuid)
+AND chirps.deleted_at IS NULL
+AND users.delete_after IS NULL
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListTrendingHashtags :many
+SELECT hashtags.tag, COUNT(*) AS chirp_count FROM chirp_hashtags
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE chirp_hashtags.created_at > sqlc.arg(since)::timestamp
+GROUP BY hashtags.tag
+ORDER BY chirp_count DESC, hashtags.tag ASC
+LIMIT sqlc.arg(max_tags);
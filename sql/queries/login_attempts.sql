@@ -0,0 +1,21 @@
+-- name: CreateLoginAttempt :exec
+INSERT INTO login_attempts (id, email, user_id, ip_address, user_agent, outcome, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW()
+);
+
+-- name: DeleteLoginAttemptsByEmail :exec
+DELETE FROM login_attempts
+WHERE LOWER(email) = LOWER(sqlc.arg(email));
+
+-- name: ListUserLoginAttempts :many
+-- Refused attempts aren't always tied to the user, so match the email too.
+SELECT * FROM login_attempts
+WHERE user_id = sqlc.arg(user_id) OR LOWER(email) = LOWER(sqlc.arg(email))
+ORDER BY created_at;
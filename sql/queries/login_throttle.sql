@@ -0,0 +1,32 @@
+-- name: GetLoginThrottle :one
+SELECT * FROM login_throttle
+WHERE throttle_key = $1;
+
+-- name: AddLoginFailure :one
+-- A previous failure older than reset_before has expired, so the count
+-- starts over.
+INSERT INTO login_throttle (throttle_key, failures, last_failure_at)
+VALUES (sqlc.arg(throttle_key), 1, sqlc.arg(failed_at))
+ON CONFLICT (throttle_key) DO UPDATE
+SET failures = CASE
+        WHEN login_throttle.last_failure_at < sqlc.arg(reset_before) THEN 1
+        ELSE login_throttle.failures + 1
+    END,
+    last_failure_at = sqlc.arg(failed_at)
+RETURNING *;
+
+-- name: LockLoginThrottle :exec
+UPDATE login_throttle
+SET locked_until = $1
+WHERE throttle_key = $2;
+
+-- name: DeleteLoginThrottle :exec
+DELETE FROM login_throttle
+WHERE throttle_key = $1;
+
+-- name: DeleteStaleLoginThrottles :execrows
+-- Rows whose last failure has expired and whose lock is over count for
+-- nothing any more.
+DELETE FROM login_throttle
+WHERE last_failure_at < sqlc.arg(reset_before)
+AND (locked_until IS NULL OR locked_until < NOW());
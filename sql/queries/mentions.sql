@@ -0,0 +1,31 @@
+-- name: AddChirpMentions :exec
+INSERT INTO mentions (chirp_id, user_id, created_at)
+SELECT sqlc.arg(chirp_id)::uuid, users.id, NOW() FROM users
+WHERE LOWER(users.username) = ANY(sqlc.arg(usernames)::text[])
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- name: DeleteChirpMentions :exec
+DELETE FROM mentions
+WHERE chirp_id = $1;
+
+-- name: ListChirpMentions :many
+SELECT mentions.chirp_id, users.id AS user_id, users.username FROM mentions
+JOIN users ON users.id = mentions.user_id
+WHERE mentions.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY users.username ASC;
+
+-- name: ListMentionChirps :many
+SELECT chirps.* FROM chirps
+JOIN mentions ON mentions.chirp_id = chirps.id
+JOIN users ON users.id = chirps.user_id
+WHERE mentions.user_id = sqlc.arg(user_id)
+AND (chirps.created_at, chirps.id) < (sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::uuid)
+AND chirps.deleted_at IS NULL
+AND users.delete_after IS NULL
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListUserMentions :many
+SELECT * FROM mentions
+WHERE user_id = $1
+ORDER BY created_at;
@@ -0,0 +1,50 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, user_id, name, token_hash, token_prefix, scopes, created_at, updated_at, expires_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW(),
+    NOW(),
+    $6
+)
+RETURNING *;
+
+-- name: ListPersonalAccessTokens :many
+SELECT * FROM personal_access_tokens
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: GetPersonalAccessToken :one
+SELECT * FROM personal_access_tokens
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetPersonalAccessTokenByHash :one
+-- Tokens of accounts scheduled for deletion don't count.
+SELECT personal_access_tokens.* FROM personal_access_tokens
+JOIN users ON users.id = personal_access_tokens.user_id
+WHERE token_hash = $1 AND users.delete_after IS NULL;
+
+-- name: UpdatePersonalAccessToken :one
+UPDATE personal_access_tokens
+SET name = $1, scopes = $2, updated_at = NOW()
+WHERE id = $3 AND user_id = $4
+RETURNING *;
+
+-- name: DeletePersonalAccessToken :execrows
+DELETE FROM personal_access_tokens
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteAllPersonalAccessTokens :exec
+DELETE FROM personal_access_tokens
+WHERE user_id = $1;
+
+-- name: TouchPersonalAccessToken :exec
+-- Only writes last_used_at about once a minute, a busy bot would otherwise
+-- update the row on every request.
+UPDATE personal_access_tokens
+SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
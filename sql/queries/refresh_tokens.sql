@@ -1,11 +1,17 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token,created_at,updated_at,user_id,expires_at)
+INSERT INTO refresh_tokens (token,created_at,updated_at,user_id,expires_at,family_id,user_agent,ip_address,last_used_at,client_id,scopes)
 VALUES (
     $1,
     NOW(),
     NOW(),
     $2,
-    $3
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW(),
+    $7,
+    COALESCE($8::text[], '{}')
 ) RETURNING *;
 
 
@@ -17,4 +23,42 @@ WHERE token = $1;
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens 
 SET updated_at = NOW(),revoked_at = NOW()
-WHERE token = $1;
\ No newline at end of file
+WHERE token = $1;
+
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW(), replaced_by = sqlc.arg(replaced_by)::text
+WHERE token = sqlc.arg(token) AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+
+-- name: ListActiveSessions :many
+SELECT refresh_tokens.family_id, refresh_tokens.user_agent, refresh_tokens.ip_address, refresh_tokens.last_used_at, refresh_tokens.expires_at,
+    (SELECT MIN(first.created_at) FROM refresh_tokens first WHERE first.family_id = refresh_tokens.family_id)::timestamp AS started_at,
+    oauth_clients.name AS client_name
+FROM refresh_tokens
+LEFT JOIN oauth_clients ON oauth_clients.id = refresh_tokens.client_id
+WHERE refresh_tokens.user_id = $1 AND refresh_tokens.revoked_at IS NULL AND refresh_tokens.expires_at > NOW()
+ORDER BY refresh_tokens.last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: ListUserRefreshTokens :many
+SELECT refresh_tokens.family_id, refresh_tokens.created_at, refresh_tokens.last_used_at, refresh_tokens.expires_at, refresh_tokens.revoked_at,
+    refresh_tokens.user_agent, refresh_tokens.ip_address, refresh_tokens.scopes, oauth_clients.name AS client_name
+FROM refresh_tokens
+LEFT JOIN oauth_clients ON oauth_clients.id = refresh_tokens.client_id
+WHERE refresh_tokens.user_id = $1
+ORDER BY refresh_tokens.created_at;
@@ -0,0 +1,16 @@
+-- name: SearchChirps :many
+SELECT sqlc.embed(chirps),
+    ts_rank(chirps.search_vector, websearch_to_tsquery('english', sqlc.arg(query)::text))::real AS rank,
+    ts_headline('english', chirps.body, websearch_to_tsquery('english', sqlc.arg(query)::text), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')::text AS snippet
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.search_vector @@ websearch_to_tsquery('english', sqlc.arg(query)::text)
+AND chirps.deleted_at IS NULL
+AND users.delete_after IS NULL
+AND (sqlc.narg(author_id)::uuid IS NULL OR chirps.user_id = sqlc.narg(author_id))
+AND (sqlc.narg(created_after)::timestamp IS NULL OR chirps.created_at >= sqlc.narg(created_after))
+AND (sqlc.narg(created_before)::timestamp IS NULL OR chirps.created_at < sqlc.narg(created_before))
+AND (ts_rank(chirps.search_vector, websearch_to_tsquery('english', sqlc.arg(query)::text)), chirps.created_at, chirps.id)
+    < (sqlc.arg(cursor_rank)::real, sqlc.arg(cursor_created_at)::timestamp, sqlc.arg(cursor_id)::uuid)
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg(page_size);
@@ -17,14 +17,104 @@ WHERE email = $1;
 SELECT * FROM users
 WHERE id = $1;
 
+-- name: GetUserByUsername :one
+SELECT * FROM users
+WHERE LOWER(username) = LOWER(sqlc.arg(username)::text);
+
 -- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2
-WHERE id = $3
+SET email = $1, hashed_password = $2, username = $3,
+    display_name = $4, bio = $5, location = $6, website = $7
+WHERE id = $8
 RETURNING *;
 
+-- name: SearchUsers :many
+SELECT * FROM users
+WHERE (LOWER(username) LIKE sqlc.arg(prefix)::text || '%'
+OR LOWER(display_name) LIKE sqlc.arg(prefix)::text || '%')
+AND delete_after IS NULL
+ORDER BY LOWER(username) = sqlc.arg(prefix)::text DESC, username ASC
+LIMIT sqlc.arg(max_results);
+
 -- name: UpgradeToIsChirpyRed :exec
 UPDATE users
 SET is_chirpy_red = true, updated_at = NOW()
 WHERE id = $1
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: GetUserTokenState :one
+SELECT tokens_valid_after, delete_after FROM users
+WHERE id = $1;
+
+-- name: RevokeUserAccessTokens :exec
+UPDATE users
+SET tokens_valid_after = sqlc.arg(valid_after)::timestamp, updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
+-- name: SetTOTPSecret :execrows
+UPDATE users
+SET totp_secret = $1, updated_at = NOW()
+WHERE id = $2 AND totp_enabled_at IS NULL;
+
+-- name: EnableTOTP :execrows
+UPDATE users
+SET totp_enabled_at = NOW(), totp_last_step = $1, updated_at = NOW()
+WHERE id = $2 AND totp_enabled_at IS NULL AND totp_secret IS NOT NULL;
+
+-- name: DisableTOTP :exec
+UPDATE users
+SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0, updated_at = NOW()
+WHERE id = $1;
+
+-- name: UseTOTPStep :execrows
+UPDATE users
+SET totp_last_step = sqlc.arg(step)::bigint
+WHERE id = sqlc.arg(id) AND totp_last_step < sqlc.arg(step)::bigint;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2;
+
+-- name: SetPendingEmail :one
+UPDATE users
+SET pending_email = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: ConfirmUserEmail :execrows
+UPDATE users
+SET email = sqlc.arg(email)::text, email_verified_at = NOW(), pending_email = NULL, updated_at = NOW()
+WHERE id = sqlc.arg(id) AND (email = sqlc.arg(email)::text OR pending_email = sqlc.arg(email)::text);
+
+-- name: RehashUserPassword :execrows
+-- Only swaps the hash if the password hasn't changed since it was checked.
+UPDATE users
+SET hashed_password = sqlc.arg(new_hash)::text
+WHERE id = sqlc.arg(id) AND hashed_password = sqlc.arg(old_hash)::text;
+
+-- name: SetUserRole :one
+UPDATE users
+SET role = $1, updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: ScheduleUserDeletion :one
+-- Asking again keeps the original schedule.
+UPDATE users
+SET deletion_requested_at = COALESCE(deletion_requested_at, NOW()),
+    delete_after = COALESCE(delete_after, sqlc.arg(delete_after)::timestamp),
+    updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: CancelUserDeletion :execrows
+UPDATE users
+SET deletion_requested_at = NULL, delete_after = NULL, updated_at = NOW()
+WHERE id = $1 AND delete_after IS NOT NULL;
+
+-- name: ListUsersDueForDeletion :many
+SELECT id, email FROM users
+WHERE delete_after <= NOW()
+ORDER BY delete_after
+LIMIT $1;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE chirps
+ADD COLUMN in_reply_to UUID DEFAULT NULL,
+ADD COLUMN deleted_at TIMESTAMP DEFAULT NULL,
+ADD CONSTRAINT fk_chirps_in_reply_to
+FOREIGN KEY (in_reply_to) REFERENCES chirps(id) ON DELETE SET NULL;
+CREATE INDEX idx_chirps_in_reply_to ON chirps (in_reply_to);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE chirps
+DROP COLUMN deleted_at,
+DROP COLUMN in_reply_to;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE chirps
+ADD COLUMN rechirp_of UUID DEFAULT NULL,
+ADD COLUMN quote_of UUID DEFAULT NULL,
+ADD CONSTRAINT fk_chirps_rechirp_of
+FOREIGN KEY (rechirp_of) REFERENCES chirps(id) ON DELETE CASCADE,
+ADD CONSTRAINT fk_chirps_quote_of
+FOREIGN KEY (quote_of) REFERENCES chirps(id) ON DELETE SET NULL;
+CREATE UNIQUE INDEX uq_chirps_user_id_rechirp_of ON chirps (user_id, rechirp_of) WHERE rechirp_of IS NOT NULL;
+CREATE INDEX idx_chirps_rechirp_of ON chirps (rechirp_of);
+CREATE INDEX idx_chirps_quote_of ON chirps (quote_of);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE chirps
+DROP COLUMN quote_of,
+DROP COLUMN rechirp_of;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE hashtags (
+    id UUID PRIMARY KEY,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT uq_hashtags_tag UNIQUE(tag)
+);
+
+CREATE TABLE chirp_hashtags (
+    chirp_id UUID NOT NULL,
+    hashtag_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, hashtag_id),
+    CONSTRAINT fk_chirp_hashtags_chirp_id
+    FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    CONSTRAINT fk_chirp_hashtags_hashtag_id
+    FOREIGN KEY (hashtag_id) REFERENCES hashtags(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_chirp_hashtags_hashtag_id ON chirp_hashtags (hashtag_id);
+CREATE INDEX idx_chirp_hashtags_created_at ON chirp_hashtags (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE chirp_hashtags;
+DROP TABLE hashtags;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN username TEXT DEFAULT NULL;
+CREATE UNIQUE INDEX uq_users_username ON users (LOWER(username));
+
+CREATE TABLE mentions (
+    chirp_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, user_id),
+    CONSTRAINT fk_mentions_chirp_id
+    FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    CONSTRAINT fk_mentions_user_id
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_mentions_user_id ON mentions (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE mentions;
+DROP INDEX uq_users_username;
+ALTER TABLE users
+DROP COLUMN username;
+-- +goose StatementEnd
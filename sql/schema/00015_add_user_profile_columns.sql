@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN display_name TEXT DEFAULT NULL,
+ADD COLUMN bio TEXT DEFAULT NULL,
+ADD COLUMN location TEXT DEFAULT NULL,
+ADD COLUMN website TEXT DEFAULT NULL;
+CREATE INDEX idx_users_username_prefix ON users (LOWER(username) text_pattern_ops);
+CREATE INDEX idx_users_display_name_prefix ON users (LOWER(display_name) text_pattern_ops);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+DROP COLUMN website,
+DROP COLUMN location,
+DROP COLUMN bio,
+DROP COLUMN display_name;
+-- +goose StatementEnd
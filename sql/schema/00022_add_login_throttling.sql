@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE login_throttle (
+    throttle_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP DEFAULT NULL
+);
+
+CREATE TABLE login_attempts (
+    id UUID PRIMARY KEY,
+    email TEXT NOT NULL,
+    user_id UUID DEFAULT NULL,
+    ip_address TEXT NOT NULL,
+    user_agent TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_login_attempts_user_id
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+CREATE INDEX idx_login_attempts_user_id_created_at ON login_attempts (user_id, created_at);
+CREATE INDEX idx_login_attempts_ip_address_created_at ON login_attempts (ip_address, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE login_attempts;
+DROP TABLE login_throttle;
+-- +goose StatementEnd
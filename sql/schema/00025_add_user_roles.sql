@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Promote the first admin by hand, after that admins can assign roles
+-- through PUT /admin/users/{userID}/role:
+--   UPDATE users SET role = 'admin' WHERE email = '...';
+ALTER TABLE users
+ADD COLUMN role TEXT NOT NULL DEFAULT 'user',
+ADD CONSTRAINT chk_users_role CHECK (role IN ('user', 'moderator', 'admin'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+DROP CONSTRAINT chk_users_role,
+DROP COLUMN role;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users
+ADD COLUMN deletion_requested_at TIMESTAMP DEFAULT NULL,
+ADD COLUMN delete_after TIMESTAMP DEFAULT NULL;
+CREATE INDEX idx_users_delete_after ON users (delete_after) WHERE delete_after IS NOT NULL;
+
+-- Outlives the account, so it holds nothing that identifies the user.
+CREATE TABLE account_deletions (
+    id UUID PRIMARY KEY,
+    account_created_on DATE NOT NULL,
+    requested_at TIMESTAMP NOT NULL,
+    deleted_at TIMESTAMP NOT NULL,
+    chirp_count INTEGER NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE account_deletions;
+DROP INDEX idx_users_delete_after;
+ALTER TABLE users
+DROP COLUMN delete_after,
+DROP COLUMN deletion_requested_at;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Edits used to re-stamp a chirp's hashtags with the time of the edit.
+UPDATE chirp_hashtags
+SET created_at = chirps.created_at
+FROM chirps
+WHERE chirps.id = chirp_hashtags.chirp_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- The edit times were never kept, so there is nothing to restore.
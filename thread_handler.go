@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+type ThreadNode struct {
+	ChirpResponse
+	Replies []ThreadNode `json:"replies"`
+}
+
+type ThreadResponse struct {
+	Ancestors []ChirpResponse `json:"ancestors"`
+	Chirp     ThreadNode      `json:"chirp"`
+}
+
+func (cfg *apiConfig) handleGetChirpReplies(w http.ResponseWriter, r *http.Request) {
+	chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("error parsing chirpID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id")
+		return
+	}
+
+	if _, err = cfg.Db.GetChirp(r.Context(), chirpid); err != nil {
+		log.Printf("chirp not found: %s", err)
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+
+	replies, err := cfg.Db.ListReplies(r.Context(), chirpid)
+	if err != nil {
+		log.Printf("error fetching replies: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching replies")
+		return
+	}
+
+	response, err := cfg.chirpResponses(r.Context(), replies, cfg.viewerID(r))
+	if err != nil {
+		log.Printf("error building chirp responses: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching replies")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+func (cfg *apiConfig) handleGetChirpThread(w http.ResponseWriter, r *http.Request) {
+	chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		log.Printf("error parsing chirpID: %s", err)
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id")
+		return
+	}
+
+	chirp, err := cfg.Db.GetChirp(r.Context(), chirpid)
+	if err != nil {
+		log.Printf("chirp not found: %s", err)
+		respondWithError(w, http.StatusNotFound, "chirp not found")
+		return
+	}
+
+	ancestors, err := cfg.Db.GetChirpAncestors(r.Context(), chirp.ID)
+	if err != nil {
+		log.Printf("error fetching chirp ancestors: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching thread")
+		return
+	}
+
+	descendants, err := cfg.Db.GetChirpDescendants(r.Context(), chirp.ID)
+	if err != nil {
+		log.Printf("error fetching chirp descendants: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching thread")
+		return
+	}
+
+	chirps := append(append([]database.Chirp{chirp}, ancestors...), descendants...)
+	responses, err := cfg.chirpResponses(r.Context(), chirps, cfg.viewerID(r))
+	if err != nil {
+		log.Printf("error building chirp responses: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "error fetching thread")
+		return
+	}
+
+	response := ThreadResponse{
+		Ancestors: responses[1 : 1+len(ancestors)],
+		Chirp:     buildThread(responses[0], responses[1+len(ancestors):]),
+	}
+
+	respondWithJSON(w, http.StatusOK, response)
+}
+
+// buildThread arranges the descendants of root into a reply tree. The
+// descendants are expected oldest first so replies keep that order.
+func buildThread(root ChirpResponse, descendants []ChirpResponse) ThreadNode {
+	children := map[uuid.UUID][]ChirpResponse{}
+	for _, chirp := range descendants {
+		children[*chirp.InReplyTo] = append(children[*chirp.InReplyTo], chirp)
+	}
+
+	var build func(chirp ChirpResponse) ThreadNode
+	build = func(chirp ChirpResponse) ThreadNode {
+		node := ThreadNode{ChirpResponse: chirp, Replies: []ThreadNode{}}
+		for _, child := range children[chirp.ID] {
+			node.Replies = append(node.Replies, build(child))
+		}
+		return node
+	}
+
+	return build(root)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/database"
+)
+
+const (
+	challengeTokenLifetime = 5 * time.Minute
+	recoveryCodeCount      = 10
+	totpIssuer             = "Chirpy"
+)
+
+type LoginChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+type totpParams struct {
+	Code             string `json:"code"`
+	ChallengeToken   string `json:"challenge_token"`
+	ExpiresInSeconds int    `json:"expires_in_seconds"`
+}
+
+func (cfg *apiConfig) handleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	user, err := cfg.Db.GetUserById(r.Context(), userid)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("error generating totp secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't start two-factor enrollment")
+		return
+	}
+
+	// Enrolling again before confirming replaces the pending secret, which
+	// covers users who lost the first QR code.
+	updated, err := cfg.Db.SetTOTPSecret(r.Context(), database.SetTOTPSecretParams{
+		TotpSecret: sql.NullString{String: secret, Valid: true},
+		ID:         user.ID,
+	})
+	if err != nil {
+		log.Printf("error storing totp secret: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't start two-factor enrollment")
+		return
+	}
+	if updated == 0 {
+		respondWithError(w, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		Secret string `json:"secret"`
+		URI    string `json:"otpauth_uri"`
+	}{Secret: secret, URI: auth.TOTPURI(totpIssuer, user.Email, secret)})
+}
+
+func (cfg *apiConfig) handleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	params := totpParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+
+	user, err := cfg.Db.GetUserById(r.Context(), userid)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(w, http.StatusBadRequest, "two-factor enrollment has not been started")
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret.String, params.Code, time.Now(), 0)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+
+	codes, err := cfg.replaceRecoveryCodes(r.Context(), user)
+	if err != nil {
+		log.Printf("error creating recovery codes: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't enable two-factor authentication")
+		return
+	}
+
+	enabled, err := cfg.Db.EnableTOTP(r.Context(), database.EnableTOTPParams{
+		TotpLastStep: step,
+		ID:           user.ID,
+	})
+	if err != nil || enabled == 0 {
+		log.Printf("error enabling totp: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't enable two-factor authentication")
+		return
+	}
+
+	logSecurityEvent(r, "2fa_enabled", user.ID, "totp enabled")
+	respondWithJSON(w, http.StatusOK, struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{RecoveryCodes: codes})
+}
+
+func (cfg *apiConfig) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userid := principal(r).UserID
+
+	params := totpParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+
+	user, err := cfg.Db.GetUserById(r.Context(), userid)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
+		respondWithError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusBadRequest, "two-factor authentication is not enabled")
+		return
+	}
+
+	// A stolen access token alone shouldn't be enough to strip 2FA.
+	ok, err := cfg.checkSecondFactor(r.Context(), user, params.Code)
+	if err != nil {
+		log.Printf("error checking second factor: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't disable two-factor authentication")
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+
+	if err = cfg.Db.DisableTOTP(r.Context(), user.ID); err != nil {
+		log.Printf("error disabling totp: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "couldn't disable two-factor authentication")
+		return
+	}
+	if err = cfg.Db.DeleteRecoveryCodes(r.Context(), user.ID); err != nil {
+		log.Printf("error deleting recovery codes: %s", err)
+	}
+
+	logSecurityEvent(r, "2fa_disabled", user.ID, "totp disabled")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleLoginTOTP is the second step of a two-factor login: it trades the
+// challenge token from handleLogin plus a TOTP or recovery code for a
+// session.
+func (cfg *apiConfig) handleLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	params := totpParams{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		log.Printf("error parsing request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, "could not parse request body")
+		return
+	}
+
+	userid, err := cfg.jwt_keys.ValidateChallengeJWT(params.ChallengeToken)
+	if err != nil {
+		log.Printf("invalid challenge token: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "invalid challenge token")
+		return
+	}
+
+	user, err := cfg.Db.GetUserById(r.Context(), userid)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
+		respondWithError(w, http.StatusUnauthorized, "invalid challenge token")
+		return
+	}
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(w, http.StatusUnauthorized, "invalid challenge token")
+		return
+	}
+
+	if !cfg.checkLoginThrottle(w, r, user.Email) {
+		return
+	}
+
+	ok, err := cfg.checkSecondFactor(r.Context(), user, params.Code)
+	if err != nil {
+		log.Printf("error checking second factor: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong please try again.")
+		return
+	}
+	if !ok {
+		cfg.loginFailed(r, user.Email, &user, outcomeBadSecondFactor)
+		respondWithError(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+
+	cfg.loginSucceeded(r, user)
+	cfg.completeLogin(w, r, user, params.ExpiresInSeconds)
+}
+
+// sendLoginChallenge answers a login that got past the first factor with a
+// challenge token for handleLoginTOTP.
+func (cfg *apiConfig) sendLoginChallenge(w http.ResponseWriter, r *http.Request, user database.User) {
+	cfg.recordLoginAttempt(r, user.Email, user.ID, outcomeSecondFactorRequired)
+	challenge, err := cfg.jwt_keys.MakeChallengeJWT(user.ID, challengeTokenLifetime)
+	if err != nil {
+		log.Printf("Error forming challenge jwt: %s", err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Something went wrong please try again.")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, LoginChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+	})
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code, consuming whichever matched so it can't be used again.
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context, user database.User, code string) (bool, error) {
+	if step, ok := auth.ValidateTOTP(user.TotpSecret.String, code, time.Now(), user.TotpLastStep); ok {
+		// The conditional update loses if a concurrent request used the
+		// same code first.
+		used, err := cfg.Db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			Step: step,
+			ID:   user.ID,
+		})
+		return used == 1, err
+	}
+
+	// Recovery codes are hashed like passwords, so a wrong TOTP code
+	// shouldn't cost a round of checking them all.
+	if auth.IsTOTPCode(code) {
+		return false, nil
+	}
+
+	codes, err := cfg.Db.ListUnusedRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+	normalized := auth.NormalizeRecoveryCode(code)
+	for _, recovery := range codes {
+		match, err := auth.CheckPasswordHash(normalized, recovery.CodeHash)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			used, err := cfg.Db.UseRecoveryCode(ctx, recovery.ID)
+			return used == 1, err
+		}
+	}
+	return false, nil
+}
+
+// replaceRecoveryCodes discards any existing recovery codes and returns a
+// fresh set. Only hashes are stored, so this is the one chance to show them.
+func (cfg *apiConfig) replaceRecoveryCodes(ctx context.Context, user database.User) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cfg.Db.DeleteRecoveryCodes(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		hash, err := auth.HashPassword(auth.NormalizeRecoveryCode(code))
+		if err != nil {
+			return nil, err
+		}
+		if err = cfg.Db.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: hash,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
@@ -1,20 +1,32 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/zic20/chirpy/internal/auth"
+	"github.com/zic20/chirpy/internal/authn"
+	"github.com/zic20/chirpy/internal/chirptext"
 	"github.com/zic20/chirpy/internal/database"
 )
 
+const refreshTokenLifetime = 1440 * time.Hour
+
 type authParams struct {
-	Email            string `json:"email"`
-	Password         string `json:"password"`
-	ExpiresInSeconds int    `json:"expires_in_seconds"`
+	Email            string  `json:"email"`
+	Password         string  `json:"password"`
+	CurrentPassword  string  `json:"current_password"`
+	Username         string  `json:"username"`
+	DisplayName      *string `json:"display_name"`
+	Bio              *string `json:"bio"`
+	Location         *string `json:"location"`
+	Website          *string `json:"website"`
+	ExpiresInSeconds int     `json:"expires_in_seconds"`
 }
 
 type ResponseUser struct {
@@ -22,17 +34,47 @@ type ResponseUser struct {
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	Email        string    `json:"email"`
+	Username     string    `json:"username,omitempty"`
 	Token        string    `json:"token"`
 	RefreshToken string    `json:"refresh_token"`
 	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	Role         string    `json:"role"`
 }
 
 type User struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	Username      string    `json:"username,omitempty"`
+	DisplayName   string    `json:"display_name,omitempty"`
+	Bio           string    `json:"bio,omitempty"`
+	Location      string    `json:"location,omitempty"`
+	Website       string    `json:"website,omitempty"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	TwoFactor     bool      `json:"two_factor_enabled"`
+	Role          string    `json:"role"`
+}
+
+func newUser(user database.User) User {
+	return User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  user.PendingEmail.String,
+		Username:      user.Username.String,
+		DisplayName:   user.DisplayName.String,
+		Bio:           user.Bio.String,
+		Location:      user.Location.String,
+		Website:       user.Website.String,
+		IsChirpyRed:   user.IsChirpyRed,
+		TwoFactor:     user.TotpEnabledAt.Valid,
+		Role:          user.Role,
+	}
 }
 
 func (cfg *apiConfig) handleCreateUser(w http.ResponseWriter, r *http.Request) {
@@ -46,6 +88,15 @@ func (cfg *apiConfig) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err = auth.ValidateEmail(reqBody.Email); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !checkPassword(w, reqBody.Password, reqBody.Email) {
+		return
+	}
+
 	hash, err := auth.HashPassword(reqBody.Password)
 	if err != nil {
 		log.Printf("error hashing user password: %s", err.Error())
@@ -62,31 +113,16 @@ func (cfg *apiConfig) handleCreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resBody := User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+	if err = cfg.sendEmailVerification(r.Context(), user, user.Email); err != nil {
+		log.Printf("error sending email verification: %s", err)
 	}
 
-	respondWithJSON(w, 201, resBody)
+	respondWithJSON(w, 201, newUser(user))
 
 }
 
 func (cfg *apiConfig) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
-	userid, err := auth.ValidateJWT(token, cfg.jwt_secret)
-	if err != nil {
-		log.Print(err.Error())
-		respondWithError(w, http.StatusUnauthorized, "invalid token")
-		return
-	}
+	userid := principal(r).UserID
 
 	user, err := cfg.Db.GetUserById(r.Context(), userid)
 	if err != nil {
@@ -103,9 +139,25 @@ func (cfg *apiConfig) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Changing credentials is an account takeover in the wrong hands, so it
+	// takes a password login and the current password, not just a token
+	// holding profile:write.
+	if reqBody.Password != "" || (reqBody.Email != "" && reqBody.Email != user.Email) {
+		if principal(r).Kind != authn.KindSession {
+			respondWithError(w, http.StatusForbidden, "changing email or password requires a password login")
+			return
+		}
+		if !cfg.confirmPassword(w, r, user, reqBody.CurrentPassword) {
+			return
+		}
+	}
+
 	password_hash := user.HashedPassword
-	email := user.Email
+	username := user.Username
 	if reqBody.Password != "" {
+		if !checkPassword(w, reqBody.Password, user.Email, reqBody.Email, user.Username.String, reqBody.Username) {
+			return
+		}
 		password_hash, err = auth.HashPassword(reqBody.Password)
 		if err != nil {
 			log.Printf("error hashing user password: %s", err.Error())
@@ -114,25 +166,79 @@ func (cfg *apiConfig) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if reqBody.Email != "" {
-		email = reqBody.Email
+	// A new email only replaces the current one once it's verified, until
+	// then the old address keeps receiving mail and logging in.
+	pending_email := ""
+	if reqBody.Email != "" && reqBody.Email != user.Email {
+		if err = auth.ValidateEmail(reqBody.Email); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := cfg.Db.GetUserByEmail(r.Context(), reqBody.Email); err == nil {
+			respondWithError(w, http.StatusConflict, "email is already in use")
+			return
+		}
+		pending_email = reqBody.Email
+	}
+
+	if reqBody.Username != "" {
+		if err = chirptext.ValidateUsername(reqBody.Username); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		existing, err := cfg.Db.GetUserByUsername(r.Context(), reqBody.Username)
+		if err == nil && existing.ID != userid {
+			respondWithError(w, http.StatusConflict, "username is already taken")
+			return
+		}
+		username = sql.NullString{String: reqBody.Username, Valid: true}
+	}
+
+	params := database.UpdateUserParams{Email: user.Email, HashedPassword: password_hash, Username: username, ID: userid}
+	for _, field := range []struct {
+		name      string
+		current   sql.NullString
+		update    *string
+		maxLength int
+		value     *sql.NullString
+	}{
+		{"display_name", user.DisplayName, reqBody.DisplayName, maxDisplayNameLength, &params.DisplayName},
+		{"bio", user.Bio, reqBody.Bio, maxBioLength, &params.Bio},
+		{"location", user.Location, reqBody.Location, maxLocationLength, &params.Location},
+		{"website", user.Website, reqBody.Website, maxWebsiteLength, &params.Website},
+	} {
+		if *field.value, err = profileField(field.current, field.update, field.name, field.maxLength); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if err = validateWebsite(params.Website); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	updatedUser, err := cfg.Db.UpdateUser(r.Context(), database.UpdateUserParams{Email: email, HashedPassword: password_hash, ID: userid})
+	updatedUser, err := cfg.Db.UpdateUser(r.Context(), params)
 	if err != nil {
 		log.Printf("error updating user's account: %s", err)
 		respondWithError(w, http.StatusOK, "couldn't update user's account")
 		return
 	}
-	resBody := User{
-		ID:          updatedUser.ID,
-		CreatedAt:   updatedUser.CreatedAt,
-		UpdatedAt:   updatedUser.UpdatedAt,
-		Email:       updatedUser.Email,
-		IsChirpyRed: updatedUser.IsChirpyRed,
-	}
 
-	respondWithJSON(w, 200, resBody)
+	if pending_email != "" {
+		updatedUser, err = cfg.Db.SetPendingEmail(r.Context(), database.SetPendingEmailParams{
+			PendingEmail: sql.NullString{String: pending_email, Valid: true},
+			ID:           userid,
+		})
+		if err != nil {
+			log.Printf("error storing pending email: %s", err)
+			respondWithError(w, http.StatusInternalServerError, "couldn't update user's account")
+			return
+		}
+		if err = cfg.sendEmailVerification(r.Context(), updatedUser, pending_email); err != nil {
+			log.Printf("error sending email verification: %s", err)
+		}
+	}
+	respondWithJSON(w, 200, newUser(updatedUser))
 
 }
 
@@ -146,9 +252,14 @@ func (cfg *apiConfig) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !cfg.checkLoginThrottle(w, r, reqBody.Email) {
+		return
+	}
+
 	user, err := cfg.Db.GetUserByEmail(r.Context(), reqBody.Email)
 	if err != nil {
 		log.Printf("user not found: %s", err.Error())
+		cfg.loginFailed(r, reqBody.Email, nil, outcomeBadCredentials)
 		respondWithError(w, http.StatusUnauthorized, "username or password incorrect")
 		return
 	}
@@ -162,15 +273,33 @@ func (cfg *apiConfig) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 	if !match {
 		log.Print("incorrect password")
+		cfg.loginFailed(r, reqBody.Email, &user, outcomeBadCredentials)
 		respondWithError(w, http.StatusUnauthorized, "username or password incorrect")
 		return
 	}
+
+	cfg.rehashPassword(r.Context(), user, reqBody.Password)
+
+	// Failures are only cleared once the second factor is in too, otherwise
+	// knowing the password would buy unlimited guesses at the code.
+	if user.TotpEnabledAt.Valid {
+		cfg.sendLoginChallenge(w, r, user)
+		return
+	}
+
+	cfg.loginSucceeded(r, user)
+	cfg.completeLogin(w, r, user, reqBody.ExpiresInSeconds)
+}
+
+// completeLogin starts a new session for a fully authenticated user and
+// responds with its access and refresh tokens.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User, expiresInSeconds int) {
 	expires_in := time.Hour
-	if reqBody.ExpiresInSeconds > 0 && reqBody.ExpiresInSeconds < 3600 {
-		expires_in = time.Second * time.Duration(reqBody.ExpiresInSeconds)
+	if expiresInSeconds > 0 && expiresInSeconds < 3600 {
+		expires_in = time.Second * time.Duration(expiresInSeconds)
 	}
 
-	token, err := auth.MakeJWT(user.ID, cfg.jwt_secret, expires_in)
+	token, err := cfg.jwt_keys.MakeJWT(user.ID, user.Role, expires_in)
 	if err != nil {
 		log.Printf("Error forming jwt: %s", err.Error())
 		respondWithError(w, http.StatusInternalServerError, err.Error())
@@ -178,11 +307,19 @@ func (cfg *apiConfig) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	refresh_token_string, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating refresh token: %s", err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
 
 	refresh_token, err := cfg.Db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
 		Token:     refresh_token_string,
 		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(time.Hour * 1440),
+		ExpiresAt: time.Now().Add(refreshTokenLifetime),
+		FamilyID:  uuid.New(),
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
 	})
 	if err != nil {
 		log.Printf("Error storing refresh token: %s", err.Error())
@@ -194,9 +331,11 @@ func (cfg *apiConfig) handleLogin(w http.ResponseWriter, r *http.Request) {
 		CreatedAt:    user.CreatedAt,
 		UpdatedAt:    user.UpdatedAt,
 		Email:        user.Email,
+		Username:     user.Username.String,
 		Token:        token,
 		RefreshToken: refresh_token.Token,
 		IsChirpyRed:  user.IsChirpyRed,
+		Role:         user.Role,
 	})
 }
 
@@ -215,17 +354,32 @@ func (cfg *apiConfig) handleRefreshToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if !refresh_token.ExpiresAt.After(time.Now()) {
-		respondWithError(w, http.StatusUnauthorized, "token has expired")
+	// OAuth clients refresh through /oauth/token with their credentials.
+	if refresh_token.ClientID.Valid {
+		respondWithError(w, http.StatusUnauthorized, "invalid token")
 		return
 	}
 
-	if refresh_token.RevokedAt.Valid {
+	new_refresh_token, err := cfg.rotateRefreshToken(r, refresh_token)
+	if errors.Is(err, errInvalidRefreshToken) || errors.Is(err, errRefreshTokenExpired) {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("error rotating refresh token: %s", err)
+		respondWithError(w, http.StatusInternalServerError, "could not create new refresh token")
+		return
+	}
+
+	// The role may have changed since the session started.
+	user, err := cfg.Db.GetUserById(r.Context(), refresh_token.UserID)
+	if err != nil {
+		log.Printf("couldn't fetch user: %s", err)
 		respondWithError(w, http.StatusUnauthorized, "invalid token")
 		return
 	}
 
-	access_token, err := auth.MakeJWT(refresh_token.UserID, cfg.jwt_secret, time.Hour)
+	access_token, err := cfg.jwt_keys.MakeJWT(user.ID, user.Role, time.Hour)
 	if err != nil {
 		log.Printf("error creating new access token: %s", err)
 		respondWithError(w, http.StatusInternalServerError, "could not create new access token")
@@ -233,8 +387,74 @@ func (cfg *apiConfig) handleRefreshToken(w http.ResponseWriter, r *http.Request)
 	}
 
 	respondWithJSON(w, 200, struct {
-		Token string `json:"token"`
-	}{Token: access_token})
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}{Token: access_token, RefreshToken: new_refresh_token.Token})
+}
+
+var (
+	errInvalidRefreshToken = errors.New("invalid token")
+	errRefreshTokenExpired = errors.New("token has expired")
+)
+
+// rotateRefreshToken trades a refresh token for a new one in the same family,
+// keeping its client and scopes.
+func (cfg *apiConfig) rotateRefreshToken(r *http.Request, refresh_token database.RefreshToken) (database.RefreshToken, error) {
+	if refresh_token.RevokedAt.Valid {
+		// A rotated token coming back means either the client or someone who
+		// stole it is replaying it. We can't tell which, so kill the family.
+		if refresh_token.ReplacedBy.Valid {
+			cfg.revokeTokenFamily(r, refresh_token)
+		}
+		return database.RefreshToken{}, errInvalidRefreshToken
+	}
+
+	if !refresh_token.ExpiresAt.After(time.Now()) {
+		return database.RefreshToken{}, errRefreshTokenExpired
+	}
+
+	new_token_string, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+
+	new_refresh_token, err := cfg.Db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:     new_token_string,
+		UserID:    refresh_token.UserID,
+		ExpiresAt: time.Now().Add(refreshTokenLifetime),
+		FamilyID:  refresh_token.FamilyID,
+		UserAgent: r.UserAgent(),
+		IpAddress: clientIP(r),
+		ClientID:  refresh_token.ClientID,
+		Scopes:    refresh_token.Scopes,
+	})
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+
+	rotated, err := cfg.Db.RotateRefreshToken(r.Context(), database.RotateRefreshTokenParams{
+		ReplacedBy: new_refresh_token.Token,
+		Token:      refresh_token.Token,
+	})
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+	if rotated == 0 {
+		// Another request rotated the same token first.
+		cfg.revokeTokenFamily(r, refresh_token)
+		return database.RefreshToken{}, errInvalidRefreshToken
+	}
+
+	return new_refresh_token, nil
+}
+
+// revokeTokenFamily revokes every refresh token descended from the same login
+// as token after it was reused.
+func (cfg *apiConfig) revokeTokenFamily(r *http.Request, token database.RefreshToken) {
+	logSecurityEvent(r, "refresh_token_reuse", token.UserID, "revoking token family %s", token.FamilyID)
+	if err := cfg.Db.RevokeRefreshTokenFamily(r.Context(), token.FamilyID); err != nil {
+		log.Printf("error revoking refresh token family: %s", err)
+	}
 }
 
 func (cfg *apiConfig) handleRevokeRefreshToken(w http.ResponseWriter, r *http.Request) {